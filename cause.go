@@ -0,0 +1,45 @@
+package waitloop
+
+import (
+	"sync"
+	"time"
+)
+
+type closeCause struct {
+	err error
+	at  time.Time
+}
+
+// causes remembers why listener channels were closed with an error
+type causes struct {
+	mu     sync.Mutex
+	byChan map[<-chan Event]closeCause
+}
+
+func (c *causes) record(ch <-chan Event, err error, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byChan == nil {
+		c.byChan = map[<-chan Event]closeCause{}
+	}
+	c.byChan[ch] = closeCause{err: err, at: at}
+}
+
+func (c *causes) prune(before time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch, cause := range c.byChan {
+		if cause.at.Before(before) {
+			delete(c.byChan, ch)
+		}
+	}
+}
+
+// CloseCause reports why a channel returned by one of the Wait methods was closed: ErrTimedOut,
+// ErrLoopTerminated, ErrCanceled and so on; it is nil if the channel got a normal event, is still
+// open, or closed more than a TTL ago
+func (l *Loop) CloseCause(ch <-chan Event) error {
+	l.causes.mu.Lock()
+	defer l.causes.mu.Unlock()
+	return l.causes.byChan[ch].err
+}
@@ -0,0 +1,132 @@
+package waitloop_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+	"github.com/fsufitch/waitloop/fakeclock"
+)
+
+func TestCloseCauseOfEachEnding(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+		ch := l.Wait("key")
+		waitListeners(t, l, 1)
+		advance(t, l, clock, 2*time.Minute)
+		recv(t, ch)
+		if err := l.CloseCause(ch); err != waitloop.ErrTimedOut {
+			t.Fatalf("got %v, want ErrTimedOut", err)
+		}
+	})
+	t.Run("terminate", func(t *testing.T) {
+		l := newLoop(t, nil)
+		ch := l.Wait("key")
+		waitListeners(t, l, 1)
+		l.Terminate()
+		recv(t, ch)
+		if err := l.CloseCause(ch); err != waitloop.ErrLoopTerminated {
+			t.Fatalf("got %v, want ErrLoopTerminated", err)
+		}
+	})
+	t.Run("cancel", func(t *testing.T) {
+		l := newLoop(t, nil)
+		ch, cancel := l.WaitCancelable("key")
+		waitListeners(t, l, 1)
+		cancel()
+		cancelled(t, ch, waitloop.ErrCanceled)
+		if err := l.CloseCause(ch); err != waitloop.ErrCanceled {
+			t.Fatalf("got %v, want ErrCanceled", err)
+		}
+	})
+	t.Run("context", func(t *testing.T) {
+		l := newLoop(t, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := l.WaitContext(ctx, "key")
+		waitListeners(t, l, 1)
+		cancel()
+		cancelled(t, ch, context.Canceled)
+		if err := l.CloseCause(ch); err != context.Canceled {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	})
+	t.Run("key cancel", func(t *testing.T) {
+		l := newLoop(t, nil)
+		ch := l.Wait("key")
+		waitListeners(t, l, 1)
+		l.Cancel("key")
+		cancelled(t, ch, waitloop.ErrCanceled)
+		if err := l.CloseCause(ch); err != waitloop.ErrCanceled {
+			t.Fatalf("got %v, want ErrCanceled", err)
+		}
+	})
+}
+
+func TestCloseCauseOfAWaitN(t *testing.T) {
+	endings := []struct {
+		name string
+		end  func(t *testing.T, l *waitloop.Loop, clock *fakeclock.Clock)
+		want error
+	}{
+		{"timeout", func(t *testing.T, l *waitloop.Loop, clock *fakeclock.Clock) {
+			advance(t, l, clock, 2*time.Minute)
+		}, waitloop.ErrTimedOut},
+		{"terminate", func(_ *testing.T, l *waitloop.Loop, _ *fakeclock.Clock) {
+			l.Terminate()
+		}, waitloop.ErrLoopTerminated},
+		{"cancel", func(_ *testing.T, l *waitloop.Loop, _ *fakeclock.Clock) {
+			l.Cancel("key")
+		}, waitloop.ErrCanceled},
+	}
+	for _, c := range endings {
+		t.Run(c.name, func(t *testing.T) {
+			l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+			ch := l.WaitN("key", 2)
+			waitListeners(t, l, 1)
+			send(t, l, waitloop.Event{Key: "key", Data: 1})
+			recv(t, ch)
+
+			c.end(t, l, clock)
+			if e := recv(t, ch); e.Error != c.want {
+				t.Fatalf("got %+v, want %v", e, c.want)
+			}
+			closed(t, ch)
+			if err := l.CloseCause(ch); err != c.want {
+				t.Fatalf("CloseCause is %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestCloseCauseIsNilWithoutAnError(t *testing.T) {
+	l := newLoop(t, nil)
+	open := l.Wait("open")
+	fired := l.Wait("fired")
+	waitListeners(t, l, 2)
+	send(t, l, waitloop.Event{Key: "fired"})
+	recv(t, fired)
+
+	if err := l.CloseCause(fired); err != nil {
+		t.Fatalf("got %v for a channel that got its event", err)
+	}
+	if err := l.CloseCause(open); err != nil {
+		t.Fatalf("got %v for a channel that is still open", err)
+	}
+}
+
+func TestCloseCauseIsForgottenAfterATTL(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+	advance(t, l, clock, 2*time.Minute)
+	recv(t, ch)
+	if l.CloseCause(ch) == nil {
+		t.Fatal("cause not recorded")
+	}
+
+	advance(t, l, clock, 2*time.Minute)
+	if err := l.CloseCause(ch); err != nil {
+		t.Fatalf("got %v, want the cause to be pruned", err)
+	}
+}
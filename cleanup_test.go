@@ -0,0 +1,164 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+	"github.com/fsufitch/waitloop/fakeclock"
+)
+
+func TestMassExpiryDoesNotStallEvents(t *testing.T) {
+	const n = 50000
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, ListenerChannelSize: n})
+	chans := make([]<-chan waitloop.Event, n)
+	for i := range chans {
+		chans[i] = l.Wait(fmt.Sprint(i))
+	}
+	live := l.WaitTTL("live", time.Hour)
+	waitListeners(t, l, n+1)
+
+	clock.Advance(2 * time.Minute)
+	waitUntil(t, "the cleanup tick to be read", clock.Delivered)
+	start := time.Now()
+	send(t, l, waitloop.Event{Key: "live"})
+	recv(t, live)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("event took %v to get through a mass expiry", elapsed)
+	}
+
+	for _, ch := range chans {
+		if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+			t.Fatalf("got %v, want ErrTimedOut", e.Error)
+		}
+	}
+}
+
+func TestTimeoutKeys(t *testing.T) {
+	l := newLoop(t, nil)
+	a1, a2 := l.Wait("a"), l.Wait("a")
+	b := l.Wait("b")
+	other := l.Wait("other")
+	waitListeners(t, l, 4)
+
+	if n := l.TimeoutKeys([]string{"a", "b", "missing"}); n != 3 {
+		t.Fatalf("timed out %d listeners, want 3", n)
+	}
+	for _, ch := range []<-chan waitloop.Event{a1, a2, b} {
+		if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+			t.Fatalf("got %v, want ErrTimedOut", e.Error)
+		}
+		closed(t, ch)
+	}
+	noRecv(t, other)
+	waitListeners(t, l, 1)
+	if n := l.TimedOutListeners(); n != 3 {
+		t.Fatalf("TimedOutListeners is %d, want 3", n)
+	}
+
+	send(t, l, waitloop.Event{Key: "other", Data: 1})
+	if e := recv(t, other); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+}
+
+func TestExpiredListenerPassedByAnEventStillTimesOut(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, CleanupInterval: time.Hour})
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+
+	// Past the TTL but before cleanup, the event misses the listener without losing it
+	clock.Advance(2 * time.Minute)
+	if n := send(t, l, waitloop.Event{Key: "key"}); n != 0 {
+		t.Fatalf("event reached %d listeners, want none", n)
+	}
+	noRecv(t, ch)
+	advance(t, l, clock, time.Hour)
+	if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+}
+
+func TestCleanupExpiresAdjacentListeners(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	// Expiring listeners side by side, at both ends, and between survivors
+	var expiring, surviving []<-chan waitloop.Event
+	for _, survives := range []bool{false, false, true, false, false, false, true, true, false} {
+		if survives {
+			surviving = append(surviving, l.WaitTTL("key", time.Hour))
+		} else {
+			expiring = append(expiring, l.Wait("key"))
+		}
+	}
+	waitListeners(t, l, 9)
+
+	advance(t, l, clock, 2*time.Minute)
+	for _, ch := range expiring {
+		if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+			t.Fatalf("got %v, want ErrTimedOut", e.Error)
+		}
+		closed(t, ch)
+	}
+	for _, ch := range surviving {
+		noRecv(t, ch)
+	}
+	waitListeners(t, l, len(surviving))
+	if n := l.TimedOutListeners(); n != uint64(len(expiring)) {
+		t.Fatalf("counted %d timeouts, want %d", n, len(expiring))
+	}
+}
+
+func TestEventQueuedAtCleanupWinsOverExpiry(t *testing.T) {
+	// The loop picks randomly between a ready tick and a ready event, so try it both ways a few times
+	for i := 0; i < 20; i++ {
+		l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+		ch := l.Wait("key")
+		entered, release := make(chan struct{}), make(chan struct{})
+		l.WaitWithRemoveHook("block", func(error) {
+			close(entered)
+			<-release
+		})
+		waitListeners(t, l, 2)
+		l.Send(waitloop.Event{Key: "block"})
+		<-entered
+
+		// While the loop is held up, the event is sent in time, and then the listener expires
+		l.Send(waitloop.Event{Key: "key", Data: i})
+		clock.Advance(2 * time.Minute)
+		close(release)
+		if e := recv(t, ch); e.Error != nil || e.Data != i {
+			t.Fatalf("got %+v, want the event to win over expiry", e)
+		}
+		l.Terminate()
+	}
+}
+
+func TestCleanupIntervalSpellings(t *testing.T) {
+	tests := []struct {
+		name    string
+		options waitloop.LoopOptions
+	}{
+		{"correct", waitloop.LoopOptions{CleanupInterval: time.Minute}},
+		{"misspelled", waitloop.LoopOptions{CleanupInteval: time.Minute}},
+		{"both", waitloop.LoopOptions{CleanupInterval: time.Minute, CleanupInteval: time.Hour}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Not newFakeLoop, which would set CleanupInterval itself
+			clock := fakeclock.New(time.Unix(1000, 0))
+			options := test.options
+			options.TTL, options.Clock = time.Second, clock
+			l := newLoop(t, &options)
+			ch := l.Wait("key")
+			waitListeners(t, l, 1)
+
+			advance(t, l, clock, 59*time.Second)
+			noRecv(t, ch)
+			advance(t, l, clock, time.Second)
+			if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+				t.Fatalf("got %v, want ErrTimedOut on the minute's cleanup pass", e.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package waitloop
+
+import "time"
+
+// Clock is the loop's source of time: it stamps listeners and events, decides when they expire,
+// and drives the cleanup pass and the loop's other timers (see LoopOptions.Clock)
+type Clock interface {
+	Now() time.Time
+
+	// NewTicker returns a Ticker that ticks every d
+	NewTicker(d time.Duration) Ticker
+
+	// NewTimer returns a Timer that fires once, after d
+	NewTimer(d time.Duration) Timer
+}
+
+// Ticker delivers ticks on C until it is stopped, like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer delivers a single tick on C once it fires, like time.Timer; Stop and Reset report whether
+// the timer was still waiting to fire
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// realClock is the Clock reading the system time
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+
+func (t realTicker) Stop() { t.t.Stop() }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+
+func (t realTimer) Stop() bool { return t.t.Stop() }
+
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+// now is the current time on the loop's clock
+func (l *Loop) now() time.Time {
+	return l.clock.Now()
+}
@@ -0,0 +1,96 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestClockExpiresListenersAtTheirDeadline(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+
+	advance(t, l, clock, 59*time.Second)
+	noRecv(t, ch)
+
+	// Exactly at the deadline the listener has not expired yet
+	advance(t, l, clock, time.Second)
+	noRecv(t, ch)
+
+	advance(t, l, clock, time.Second)
+	if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+}
+
+func TestClockStampsListeners(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	start := clock.Now()
+	_, id := l.WaitWithID("key")
+	waitListeners(t, l, 1)
+
+	status, ok := l.Inspect(id)
+	if !ok {
+		t.Fatal("listener not found")
+	}
+	if !status.Registered.Equal(start) || !status.Expiration.Equal(start.Add(time.Minute)) {
+		t.Fatalf("got registered %v, expiring %v; want %v and a minute later", status.Registered, status.Expiration, start)
+	}
+
+	clock.Advance(20 * time.Second)
+	if remaining, _ := l.RemainingTTL(id); remaining != 40*time.Second {
+		t.Fatalf("got %v remaining, want 40s", remaining)
+	}
+}
+
+func TestClockDrivesIdleTimeout(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{IdleTimeout: 10 * time.Second})
+	// The cleanup ticker and the idle timer
+	waitUntil(t, "the idle timer", func() bool { return clock.Pending() == 2 })
+
+	clock.Advance(9 * time.Second)
+	select {
+	case <-l.Done():
+		t.Fatal("loop stopped before its idle timeout")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	clock.Advance(time.Second)
+	stopped(t, l)
+}
+
+func TestClockDrivesMaxLifetime(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{MaxLifetime: time.Hour})
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+
+	clock.Advance(time.Hour)
+	stopped(t, l)
+	if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+}
+
+func TestClockDrivesCoalesceWindow(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{CoalesceWindow: time.Second})
+	ch := l.WaitN("key", 5)
+	waitListeners(t, l, 1)
+
+	var last <-chan int
+	for i := 0; i < 3; i++ {
+		last = l.SendAck(waitloop.Event{Key: "key", Data: i})
+	}
+	waitUntil(t, "the burst to be held", func() bool { return l.SentEvents() == 3 && l.ChannelStats().EventsLen == 0 })
+	l.Ping(patience)
+	noRecv(t, ch)
+
+	advance(t, l, clock, time.Second)
+	if e := recv(t, ch); e.Data != 2 {
+		t.Fatalf("got %v, want the last event of the burst", e.Data)
+	}
+	if n := <-last; n != 1 {
+		t.Fatalf("last event acknowledged %d listeners, want 1", n)
+	}
+}
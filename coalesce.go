@@ -0,0 +1,68 @@
+package waitloop
+
+import (
+	"sort"
+	"time"
+)
+
+// coalesced is the latest event on a key, held until the CoalesceWindow opened by the first one ends
+type coalesced struct {
+	event sentEvent
+	due   time.Time
+}
+
+// coalesce holds e under LoopOptions.CoalesceWindow, in place of any event already held for its
+// key, and reports whether it did; the event it replaces is acknowledged as notifying no one
+// Events limited to some listeners are meant for the ones there now, and are never held
+func (l *Loop) coalesce(e sentEvent) bool {
+	if l.coalesceTimer == nil || e.match != nil {
+		return false
+	}
+	if held, ok := l.coalescing[e.event.Key]; ok {
+		acknowledge(held.event, 0)
+		held.event = e
+		return true
+	}
+	// Every window is as long as the others, so only the first one held needs to arm the timer
+	if len(l.coalescing) == 0 {
+		l.coalesceTimer.Reset(l.coalesceWindow)
+	}
+	l.coalescing[e.event.Key] = &coalesced{event: e, due: l.now().Add(l.coalesceWindow)}
+	return true
+}
+
+// releaseCoalesced processes the held events whose window has ended, or all of them if flush is
+// set, rearms the timer for the next, and returns how many listeners they notified
+func (l *Loop) releaseCoalesced(flush bool) int {
+	now := l.now()
+	var due []*coalesced
+	var next time.Time
+	for key, held := range l.coalescing {
+		if flush || !held.due.After(now) {
+			due = append(due, held)
+			delete(l.coalescing, key)
+			continue
+		}
+		if next.IsZero() || held.due.Before(next) {
+			next = held.due
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].due.Before(due[j].due) })
+
+	if next.IsZero() {
+		if flush && !l.coalesceTimer.Stop() {
+			select {
+			case <-l.coalesceTimer.C():
+			default:
+			}
+		}
+	} else {
+		l.coalesceTimer.Reset(next.Sub(now))
+	}
+
+	notified := 0
+	for _, held := range due {
+		notified += l.process(held.event)
+	}
+	return notified
+}
@@ -0,0 +1,60 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestCoalesceWindowCollapsesABurst(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{CoalesceWindow: time.Second})
+	ch := l.WaitN("key", 5)
+	waitListeners(t, l, 1)
+
+	for i := 0; i < 5; i++ {
+		l.Send(waitloop.Event{Key: "key", Data: i})
+	}
+	waitUntil(t, "the burst to be held", func() bool { return l.ChannelStats().EventsLen == 0 })
+	advance(t, l, clock, time.Second)
+	if e := recv(t, ch); e.Data != 4 {
+		t.Fatalf("got %v, want the last payload of the burst", e.Data)
+	}
+	noRecv(t, ch)
+}
+
+func TestCoalesceWindowDeliversSeparateWindowsSeparately(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{CoalesceWindow: time.Second})
+	ch := l.WaitN("key", 5)
+	waitListeners(t, l, 1)
+
+	for i := 0; i < 3; i++ {
+		ack := l.SendAck(waitloop.Event{Key: "key", Data: i})
+		waitUntil(t, "the event to be held", func() bool { return l.ChannelStats().EventsLen == 0 })
+		advance(t, l, clock, time.Second)
+		if e := recv(t, ch); e.Data != i {
+			t.Fatalf("got %v, want %d", e.Data, i)
+		}
+		if n, _ := acked(t, ack); n != 1 {
+			t.Fatalf("event %d acknowledged %d listeners, want 1", i, n)
+		}
+	}
+	noRecv(t, ch)
+}
+
+func TestCoalesceWindowIsPerKey(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{CoalesceWindow: time.Second})
+	a, b := l.Wait("a"), l.Wait("b")
+	waitListeners(t, l, 2)
+
+	l.Send(waitloop.Event{Key: "a", Data: 1})
+	l.Send(waitloop.Event{Key: "b", Data: 2})
+	waitUntil(t, "the events to be held", func() bool { return l.ChannelStats().EventsLen == 0 })
+	advance(t, l, clock, time.Second)
+	if e := recv(t, a); e.Data != 1 {
+		t.Fatalf("a got %v, want 1", e.Data)
+	}
+	if e := recv(t, b); e.Data != 2 {
+		t.Fatalf("b got %v, want 2", e.Data)
+	}
+}
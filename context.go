@@ -0,0 +1,74 @@
+package waitloop
+
+import "context"
+
+// WaitContext is Wait, except that the listener is cancelled with ctx.Err() if ctx is done before
+// its event arrives; it is removed from the loop at once, so later events on key pass it by
+// Like other cancellations, the channel receives that error as an Event and then closes (but see
+// LoopOptions.CloseSilentlyOnCancel)
+func (l *Loop) WaitContext(ctx context.Context, key string) <-chan Event {
+	_, bounded := ctx.Deadline()
+	out, cancel, settled := l.waitCancelable(key, ctx.Err(), bounded)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel(ctx.Err())
+		case <-settled:
+		}
+	}()
+	return out
+}
+
+// WaitCancelable is Wait, also returning a func that cancels just this listener with ErrCanceled,
+// leaving any others on key alone; calling it after the listener has finished does nothing
+func (l *Loop) WaitCancelable(key string) (<-chan Event, func()) {
+	out, cancel, _ := l.waitCancelable(key, nil, false)
+	return out, func() { cancel(ErrCanceled) }
+}
+
+// Cancel removes every listener currently registered on key, cancelling each with ErrCanceled,
+// and returns how many there were
+func (l *Loop) Cancel(key string) int {
+	return l.endKeys([]string{key}, ErrCanceled)
+}
+
+// waitCancelable registers a listener on key that cancel removes and ends with the given error;
+// settled is closed once the listener has had its final event, or the loop has stopped. If early
+// is set, the listener fails with it straight away; bounded means something else, such as a ctx
+// deadline, limits the wait, so it needs no TTL under LoopOptions.RequireExplicitTTL
+func (l *Loop) waitCancelable(key string, early error, bounded bool) (<-chan Event, func(error), <-chan struct{}) {
+	out := make(chan Event, 1)
+	settled := make(chan struct{})
+	lis := l.waitListener(key, 0)
+	if bounded {
+		lis.DefaultTTL = false
+	}
+	lis.Handler = func(e Event) {
+		close(settled)
+		l.send(out, e)
+	}
+
+	err := early
+	if err == nil {
+		err = l.admit(lis)
+	}
+	if err != nil {
+		l.fail(lis, err)
+		return out, func(error) {}, settled
+	}
+	// Registering through exec rather than the listener buffer guarantees that a cancellation
+	// never overtakes the registration
+	if !l.exec(func() { l.registerListener(lis) }) {
+		l.fail(lis, ErrLoopTerminated)
+		return out, func(error) {}, settled
+	}
+
+	cancel := func(err error) {
+		l.exec(func() {
+			if l.removeListener(key, lis.ID) {
+				l.deliver(lis, Event{Key: key, Error: err})
+			}
+		})
+	}
+	return out, cancel, settled
+}
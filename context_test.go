@@ -0,0 +1,166 @@
+package waitloop_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// cancellations registers a listener on a fresh loop and cancels it in each of the ways there are,
+// returning its channel and the error the cancellation carries
+var cancellations = []struct {
+	name   string
+	cancel func(t *testing.T, l *waitloop.Loop) (<-chan waitloop.Event, error)
+}{
+	{"WaitCancelable", func(t *testing.T, l *waitloop.Loop) (<-chan waitloop.Event, error) {
+		ch, cancel := l.WaitCancelable("key")
+		waitListeners(t, l, 1)
+		cancel()
+		return ch, waitloop.ErrCanceled
+	}},
+	{"WaitContext", func(t *testing.T, l *waitloop.Loop) (<-chan waitloop.Event, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := l.WaitContext(ctx, "key")
+		waitListeners(t, l, 1)
+		cancel()
+		return ch, context.Canceled
+	}},
+	{"Cancel", func(t *testing.T, l *waitloop.Loop) (<-chan waitloop.Event, error) {
+		ch := l.Wait("key")
+		waitListeners(t, l, 1)
+		if n := l.Cancel("key"); n != 1 {
+			t.Fatalf("Cancel removed %d listeners, want 1", n)
+		}
+		return ch, waitloop.ErrCanceled
+	}},
+	{"WaitUnless", func(t *testing.T, l *waitloop.Loop) (<-chan waitloop.Event, error) {
+		ch := l.WaitUnless("key", "stop")
+		waitListeners(t, l, 2)
+		send(t, l, waitloop.Event{Key: "stop"})
+		return ch, waitloop.ErrCanceled
+	}},
+	{"DrainListeners", func(t *testing.T, l *waitloop.Loop) (<-chan waitloop.Event, error) {
+		ch := l.Wait("key")
+		waitListeners(t, l, 1)
+		l.DrainListeners(func(string, waitloop.ListenerStatus) {})
+		return ch, waitloop.ErrCanceled
+	}},
+}
+
+func TestCancelClosesSilently(t *testing.T) {
+	for _, c := range cancellations {
+		t.Run(c.name, func(t *testing.T) {
+			l := newLoop(t, &waitloop.LoopOptions{CloseSilentlyOnCancel: true})
+			ch, want := c.cancel(t, l)
+			closed(t, ch)
+			if err := l.CloseCause(ch); err != want {
+				t.Fatalf("CloseCause is %v, want %v", err, want)
+			}
+			waitListeners(t, l, 0)
+		})
+	}
+}
+
+func TestCancelSendsAFinalEvent(t *testing.T) {
+	for _, c := range cancellations {
+		t.Run(c.name, func(t *testing.T) {
+			l := newLoop(t, nil)
+			ch, want := c.cancel(t, l)
+			if e := recv(t, ch); e.Error != want || e.Key != "key" {
+				t.Fatalf("got %+v, want an event on key with %v", e, want)
+			}
+			closed(t, ch)
+		})
+	}
+}
+
+func TestCancelLeavesOtherListenersAlone(t *testing.T) {
+	l := newLoop(t, nil)
+	ch, cancel := l.WaitCancelable("key")
+	other := l.Wait("key")
+	waitListeners(t, l, 2)
+	cancel()
+	recv(t, ch)
+	closed(t, ch)
+
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	if e := recv(t, other); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+	// Cancelling after the listener has finished does nothing
+	cancel()
+}
+
+func TestWaitContextDeadline(t *testing.T) {
+	l := newLoop(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ch := l.WaitContext(ctx, "key")
+
+	if e := recv(t, ch); e.Error != context.DeadlineExceeded || e.Key != "key" {
+		t.Fatalf("got %+v, want DeadlineExceeded on key", e)
+	}
+	closed(t, ch)
+	waitListeners(t, l, 0)
+	// The removed listener is not matched, so nothing writes to its closed channel
+	if n := send(t, l, waitloop.Event{Key: "key"}); n != 0 {
+		t.Fatalf("event reached %d listeners, want 0", n)
+	}
+}
+
+func TestWaitContextAlreadyDone(t *testing.T) {
+	l := newLoop(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ch := l.WaitContext(ctx, "key")
+	if e := recv(t, ch); e.Error != context.Canceled {
+		t.Fatalf("got %+v, want context.Canceled", e)
+	}
+	closed(t, ch)
+	if n := send(t, l, waitloop.Event{Key: "key"}); n != 0 {
+		t.Fatalf("event reached %d listeners, want 0", n)
+	}
+}
+
+func TestWaitContextEventFirst(t *testing.T) {
+	l := newLoop(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := l.WaitContext(ctx, "key")
+	waitListeners(t, l, 1)
+
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	if e := recv(t, ch); e.Data != 1 {
+		t.Fatalf("got %+v, want the event", e)
+	}
+	cancel()
+	closed(t, ch)
+	if err := l.CloseCause(ch); err != nil {
+		t.Fatalf("cancelling after the event recorded %v", err)
+	}
+}
+
+func TestCancelCountsAndSparesOtherKeys(t *testing.T) {
+	l := newLoop(t, nil)
+	chans := []<-chan waitloop.Event{l.Wait("key"), l.Wait("key"), l.Wait("key")}
+	other := l.Wait("other")
+	waitListeners(t, l, 4)
+
+	if n := l.Cancel("key"); n != 3 {
+		t.Fatalf("Cancel removed %d listeners, want 3", n)
+	}
+	for _, ch := range chans {
+		if e := recv(t, ch); e.Error != waitloop.ErrCanceled || e.Key != "key" {
+			t.Fatalf("got %+v, want ErrCanceled on key", e)
+		}
+		closed(t, ch)
+	}
+	if n := l.Cancel("key"); n != 0 {
+		t.Fatalf("second Cancel removed %d listeners, want 0", n)
+	}
+	if n := send(t, l, waitloop.Event{Key: "other", Data: 1}); n != 1 {
+		t.Fatalf("event on another key reached %d listeners, want 1", n)
+	}
+	recv(t, other)
+}
@@ -0,0 +1,66 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestDirectDeliveryReachesEveryListener(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, DirectDeliveryWhenBuffered: true})
+	fired := []<-chan waitloop.Event{l.Wait("fired"), l.Wait("fired")}
+	expiring := l.Wait("expiring")
+	terminated := l.WaitTTL("terminated", time.Hour)
+	waitListeners(t, l, 4)
+
+	send(t, l, waitloop.Event{Key: "fired", Data: 1})
+	for _, ch := range fired {
+		if e := recv(t, ch); e.Data != 1 {
+			t.Fatalf("got %v, want 1", e.Data)
+		}
+		closed(t, ch)
+	}
+	advance(t, l, clock, 2*time.Minute)
+	if e := recv(t, expiring); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+	closed(t, expiring)
+	l.Terminate()
+	if e := recv(t, terminated); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+	closed(t, terminated)
+}
+
+func TestDirectDeliveryDoesNotBlockTheLoop(t *testing.T) {
+	const n = 1000
+	l := newLoop(t, &waitloop.LoopOptions{DirectDeliveryWhenBuffered: true})
+	chans := make([]<-chan waitloop.Event, n)
+	for i := range chans {
+		chans[i] = l.Wait(fmt.Sprint(i))
+	}
+	waitListeners(t, l, n)
+
+	// Nobody reads yet: every event lands in its channel's buffer, with no goroutine left holding it
+	for i := 0; i < n; i++ {
+		send(t, l, waitloop.Event{Key: fmt.Sprint(i), Data: i})
+	}
+	if !l.Ping(patience) {
+		t.Fatal("loop blocked on unread listeners")
+	}
+	if n := l.ActiveDeliveries(); n != 0 {
+		t.Fatalf("got %d deliveries in flight, want none", n)
+	}
+	for i, ch := range chans {
+		if e := recv(t, ch); e.Data != i {
+			t.Fatalf("got %v, want %d", e.Data, i)
+		}
+	}
+}
+
+// BenchmarkDeliveryDirect is BenchmarkDeliveryPooled with buffered channels sent to from the loop
+func BenchmarkDeliveryDirect(b *testing.B) {
+	benchmarkDelivery(b, &waitloop.LoopOptions{DirectDeliveryWhenBuffered: true})
+}
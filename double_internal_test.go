@@ -0,0 +1,20 @@
+package waitloop
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectDoubleDeliveryPanics(t *testing.T) {
+	// With ManualRun nothing else touches the loop's state, so settle can be called directly
+	l := NewCustom(&LoopOptions{DetectDoubleDelivery: true, ManualRun: true})
+	lis := l.newListener("key", 0)
+	l.settle(lis, Event{Key: "key"})
+
+	defer func() {
+		if p, _ := recover().(string); !strings.Contains(p, "notified twice") {
+			t.Fatalf("got panic %q, want a double delivery report", p)
+		}
+	}()
+	l.settle(lis, Event{Key: "key"})
+}
@@ -0,0 +1,58 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// Listeners that are fired, timed out and terminated all at once must each hear exactly once; a
+// second notification would panic the loop, terminating it before the test does
+func TestDetectDoubleDeliveryRacingEndings(t *testing.T) {
+	const n = 500
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, DetectDoubleDelivery: true})
+	chans := make([]<-chan waitloop.Event, n)
+	for i := range chans {
+		chans[i] = l.Wait(fmt.Sprint(i % 50))
+	}
+	waitListeners(t, l, n)
+
+	clock.Advance(2 * time.Minute)
+	for i := 0; i < 50; i++ {
+		l.Send(waitloop.Event{Key: fmt.Sprint(i)})
+	}
+	l.TimeoutKeys([]string{"0", "1", "2"})
+	waitUntil(t, "the loop to read the clock's ticks", clock.Delivered)
+	if !l.Ping(patience) {
+		t.Fatal("loop stopped: a listener was notified twice")
+	}
+	l.Terminate()
+	stopped(t, l)
+
+	for _, ch := range chans {
+		recv(t, ch)
+		closed(t, ch)
+	}
+}
+
+func TestDetectDoubleDeliveryTerminateWithEventsQueued(t *testing.T) {
+	const n = 200
+	l := newLoop(t, &waitloop.LoopOptions{DetectDoubleDelivery: true, PanicPolicy: waitloop.PanicPropagate})
+	chans := make([]<-chan waitloop.Event, n)
+	for i := range chans {
+		chans[i] = l.Wait("key")
+	}
+	waitListeners(t, l, n)
+
+	for i := 0; i < 10; i++ {
+		l.Send(waitloop.Event{Key: "key"})
+	}
+	l.Terminate()
+	stopped(t, l)
+	for _, ch := range chans {
+		recv(t, ch)
+		closed(t, ch)
+	}
+}
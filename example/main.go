@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -29,9 +30,14 @@ func main() {
 	}
 
 	// EOF, terminate loop
-	fmt.Println("terminating loop and waiting one second for completions")
-	loop.Terminate()
-	<-time.After(1 * time.Second)
+	fmt.Println("terminating loop and waiting up to one second for completions")
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	summary, err := loop.Shutdown(ctx)
+	if err != nil {
+		fmt.Println(err)
+	}
+	fmt.Printf("%d satisfied, %d timed out, %d terminated\n", summary.Satisfied, summary.TimedOut, summary.Terminated)
 }
 
 func lineReceived(line string) {
@@ -0,0 +1,205 @@
+// Package fakeclock is a waitloop.Clock that only moves when told to, for testing TTLs and
+// cleanup without sleeping
+//
+//	clock := fakeclock.New(time.Unix(0, 0))
+//	loop := waitloop.NewCustom(&waitloop.LoopOptions{Clock: clock, TTL: time.Minute, CleanupInterval: time.Second})
+//	ch := loop.Wait("key")
+//	clock.Advance(time.Minute + time.Second)
+//	fmt.Println((<-ch).Error) // wait timed out
+package fakeclock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// Clock is a fake waitloop.Clock; it is safe for concurrent use
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*Ticker
+	timers  []*Timer
+
+	// sent holds the channels Advance has sent on, until they are read
+	sent []chan time.Time
+}
+
+// New creates a Clock reading start until it is advanced
+func New(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now reports the clock's current time
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker returns a Ticker that ticks each time Advance moves the clock past its next tick
+func (c *Clock) NewTicker(d time.Duration) waitloop.Ticker {
+	if d <= 0 {
+		panic("fakeclock: non-positive interval for NewTicker")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &Ticker{clock: c, c: make(chan time.Time, 1), interval: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// NewTimer returns a Timer that fires once Advance moves the clock d past now
+func (c *Clock) NewTimer(d time.Duration) waitloop.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &Timer{clock: c, c: make(chan time.Time, 1)}
+	c.arm(t, d)
+	return t
+}
+
+// Advance moves the clock forward by d, firing every timer and ticking every ticker that came
+// due; like time.Ticker, a ticker whose last tick has not been read yet drops the new one, so one
+// Advance over several intervals ticks once
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if t.next.After(c.now) {
+			continue
+		}
+		c.fire(t.c)
+		for !t.next.After(c.now) {
+			t.next = t.next.Add(t.interval)
+		}
+	}
+
+	var waiting []*Timer
+	for _, t := range c.timers {
+		if t.due.After(c.now) {
+			waiting = append(waiting, t)
+			continue
+		}
+		c.fire(t.c)
+	}
+	c.timers = waiting
+}
+
+// Set moves the clock to now, or does nothing if that is in the past
+func (c *Clock) Set(now time.Time) {
+	if d := now.Sub(c.Now()); d > 0 {
+		c.Advance(d)
+	}
+}
+
+// Pending reports how many timers are waiting to fire and tickers are running, so a test can
+// tell when the loop has set up the ones it needs before advancing the clock
+func (c *Clock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.tickers) + len(c.timers)
+}
+
+// Delivered reports whether every tick and timer that Advance fired has been received, so a test
+// can tell that the loop has got to them
+func (c *Clock) Delivered() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var unread []chan time.Time
+	for _, ch := range c.sent {
+		if len(ch) > 0 {
+			unread = append(unread, ch)
+		}
+	}
+	c.sent = unread
+	return len(unread) == 0
+}
+
+// fire sends the current time on ch unless it already holds an unread one; c.mu must be held
+func (c *Clock) fire(ch chan time.Time) {
+	select {
+	case ch <- c.now:
+		c.sent = append(c.sent, ch)
+	default:
+	}
+}
+
+// arm schedules t to fire d from now; c.mu must be held
+func (c *Clock) arm(t *Timer, d time.Duration) {
+	t.due = c.now.Add(d)
+	if d <= 0 {
+		c.fire(t.c)
+		return
+	}
+	c.timers = append(c.timers, t)
+}
+
+// disarm unschedules t and reports whether it was waiting to fire; c.mu must be held
+func (c *Clock) disarm(t *Timer) bool {
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Ticker is a waitloop.Ticker driven by a Clock
+type Ticker struct {
+	clock    *Clock
+	c        chan time.Time
+	interval time.Duration
+	next     time.Time
+}
+
+// C returns the channel on which ticks arrive
+func (t *Ticker) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop stops further ticks; a tick already sent stays on C
+func (t *Ticker) Stop() {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.tickers {
+		if other == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Timer is a waitloop.Timer driven by a Clock
+type Timer struct {
+	clock *Clock
+	c     chan time.Time
+	due   time.Time
+}
+
+// C returns the channel on which the timer fires
+func (t *Timer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop keeps the timer from firing, and reports whether it was still waiting to; a tick already
+// sent stays on C
+func (t *Timer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.disarm(t)
+}
+
+// Reset makes the timer fire d from now instead, and reports whether it was still waiting to fire
+func (t *Timer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := c.disarm(t)
+	c.arm(t, d)
+	return active
+}
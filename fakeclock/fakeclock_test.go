@@ -0,0 +1,81 @@
+package fakeclock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTickerTicksOncePerAdvance(t *testing.T) {
+	c := New(time.Unix(0, 0))
+	ticker := c.NewTicker(time.Second)
+
+	c.Advance(500 * time.Millisecond)
+	if len(ticker.C()) != 0 {
+		t.Fatal("ticked before its interval")
+	}
+	// Several intervals at once still leave a single tick, as time.Ticker does
+	c.Advance(3 * time.Second)
+	if got := <-ticker.C(); !got.Equal(time.Unix(3, 500*int64(time.Millisecond))) {
+		t.Fatalf("tick carried %v", got)
+	}
+	if len(ticker.C()) != 0 {
+		t.Fatal("more than one tick queued")
+	}
+
+	ticker.Stop()
+	c.Advance(time.Hour)
+	if len(ticker.C()) != 0 {
+		t.Fatal("stopped ticker ticked")
+	}
+}
+
+func TestTimerFiresOnceAtDeadline(t *testing.T) {
+	c := New(time.Unix(0, 0))
+	timer := c.NewTimer(time.Minute)
+
+	c.Advance(59 * time.Second)
+	if len(timer.C()) != 0 {
+		t.Fatal("fired early")
+	}
+	c.Advance(time.Second)
+	<-timer.C()
+	c.Advance(time.Hour)
+	if len(timer.C()) != 0 {
+		t.Fatal("fired twice")
+	}
+	if timer.Stop() {
+		t.Fatal("Stop reported a fired timer as active")
+	}
+
+	if timer.Reset(time.Second) {
+		t.Fatal("Reset reported a fired timer as active")
+	}
+	if !timer.Stop() {
+		t.Fatal("Stop reported a reset timer as inactive")
+	}
+	c.Advance(time.Second)
+	if len(timer.C()) != 0 {
+		t.Fatal("stopped timer fired")
+	}
+}
+
+func TestDeliveredAndPending(t *testing.T) {
+	c := New(time.Unix(0, 0))
+	ticker := c.NewTicker(time.Second)
+	c.NewTimer(time.Second)
+	if c.Pending() != 2 {
+		t.Fatalf("got %d pending, want 2", c.Pending())
+	}
+
+	c.Advance(time.Second)
+	if c.Pending() != 1 {
+		t.Fatalf("got %d pending after the timer fired, want 1", c.Pending())
+	}
+	if c.Delivered() {
+		t.Fatal("reported delivered while ticks are unread")
+	}
+	<-ticker.C()
+	if c.Delivered() {
+		t.Fatal("reported delivered while the timer's tick is unread")
+	}
+}
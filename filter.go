@@ -0,0 +1,30 @@
+package waitloop
+
+import "errors"
+
+// ErrFilterPanic is sent in the Event if the match func given to WaitFilter panicked
+var ErrFilterPanic = errors.New("wait filter panicked")
+
+// WaitFilter is Wait for only the events on key that match returns true for; the others go on to
+// the remaining listeners and leave this one waiting. match runs on the run goroutine, so it must
+// not block; if it panics, the listener ends with ErrFilterPanic
+func (l *Loop) WaitFilter(key string, match func(Event) bool) <-chan Event {
+	lis := l.waitListener(key, 0)
+	lis.Filter = match
+	l.register(lis)
+	return lis.Channel
+}
+
+// accepts runs the listener's Filter on e; a Filter that panics counts as a match, but failed is
+// set so that the listener gets ErrFilterPanic instead of e
+func (lis listener) accepts(e Event) (ok, failed bool) {
+	if lis.Filter == nil {
+		return true, false
+	}
+	defer func() {
+		if recover() != nil {
+			ok, failed = true, true
+		}
+	}()
+	return lis.Filter(e), false
+}
@@ -0,0 +1,67 @@
+package waitloop_test
+
+import (
+	"testing"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func even(e waitloop.Event) bool { return e.Data.(int)%2 == 0 }
+
+func TestWaitFilterMatchesSelectively(t *testing.T) {
+	l := newLoop(t, nil)
+	filtered := l.WaitFilter("key", even)
+	waitListeners(t, l, 1)
+
+	if n := send(t, l, waitloop.Event{Key: "key", Data: 1}); n != 0 {
+		t.Fatalf("rejected event reached %d listeners", n)
+	}
+	noRecv(t, filtered)
+	waitListeners(t, l, 1)
+
+	send(t, l, waitloop.Event{Key: "key", Data: 2})
+	if e := recv(t, filtered); e.Data != 2 {
+		t.Fatalf("got %v, want 2", e.Data)
+	}
+	closed(t, filtered)
+}
+
+func TestWaitFilterPassesRejectedEventsOn(t *testing.T) {
+	l := newLoop(t, nil)
+	filtered := l.WaitFilter("key", even)
+	plain := l.Wait("key")
+	waitListeners(t, l, 2)
+
+	if n := send(t, l, waitloop.Event{Key: "key", Data: 1}); n != 1 {
+		t.Fatalf("event reached %d listeners, want only the unfiltered one", n)
+	}
+	if e := recv(t, plain); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+	noRecv(t, filtered)
+	if n := send(t, l, waitloop.Event{Key: "key", Data: 4}); n != 1 {
+		t.Fatalf("event reached %d listeners, want the filtered one", n)
+	}
+	if e := recv(t, filtered); e.Data != 4 {
+		t.Fatalf("got %v, want 4", e.Data)
+	}
+}
+
+func TestWaitFilterPanics(t *testing.T) {
+	l := newLoop(t, nil)
+	// even panics on data that isn't an int
+	filtered := l.WaitFilter("key", even)
+	plain := l.Wait("key")
+	waitListeners(t, l, 2)
+
+	send(t, l, waitloop.Event{Key: "key", Data: "not an int"})
+	if e := recv(t, filtered); e.Error != waitloop.ErrFilterPanic {
+		t.Fatalf("got %+v, want ErrFilterPanic", e)
+	}
+	if e := recv(t, plain); e.Error != nil {
+		t.Fatalf("got %v, want the event", e.Error)
+	}
+	if !l.Ping(patience) {
+		t.Fatal("loop stopped after a filter panicked")
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/fsufitch/waitloop
 
-go 1.14
+go 1.18
@@ -0,0 +1,35 @@
+package waitloop
+
+import "context"
+
+// WaitGroupContext waits for every one of keys to fire, like errgroup.Wait: it returns nil once
+// they all have, or the first error otherwise (ErrTimedOut, ErrLoopTerminated, ctx.Err(), ...)
+func (l *Loop) WaitGroupContext(ctx context.Context, keys ...string) error {
+	distinct := map[string]bool{}
+	for _, key := range keys {
+		distinct[key] = true
+	}
+	if len(distinct) == 0 {
+		return nil
+	}
+
+	result := make(chan error, 1)
+	cancel := l.gather(keys, len(distinct), func(fired []Event, err *Event) {
+		if err != nil {
+			result <- err.Error
+		} else {
+			result <- nil
+		}
+	})
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		if !cancel(ctx.Err()) {
+			return ctx.Err()
+		}
+		// The group may have completed just before it was cancelled
+		return <-result
+	}
+}
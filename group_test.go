@@ -0,0 +1,101 @@
+package waitloop_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// waitGroup runs WaitGroupContext in the background, returning a channel for its result
+func waitGroup(ctx context.Context, l *waitloop.Loop, keys ...string) <-chan error {
+	result := make(chan error, 1)
+	go func() { result <- l.WaitGroupContext(ctx, keys...) }()
+	return result
+}
+
+// groupResult reads the result of waitGroup, failing the test if it takes too long
+func groupResult(t *testing.T, result <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(patience):
+		t.Fatal("timed out waiting for WaitGroupContext")
+	}
+	return nil
+}
+
+func TestWaitGroupContextAllSucceed(t *testing.T) {
+	l := newLoop(t, nil)
+	result := waitGroup(context.Background(), l, "a", "b", "a", "c")
+	waitListeners(t, l, 3)
+
+	send(t, l, waitloop.Event{Key: "a"})
+	send(t, l, waitloop.Event{Key: "c"})
+	select {
+	case err := <-result:
+		t.Fatalf("returned %v before every key fired", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	send(t, l, waitloop.Event{Key: "b"})
+	if err := groupResult(t, result); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
+
+func TestWaitGroupContextNoKeys(t *testing.T) {
+	l := newLoop(t, nil)
+	if err := l.WaitGroupContext(context.Background()); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
+
+func TestWaitGroupContextTimeout(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	result := waitGroup(context.Background(), l, "a", "b")
+	waitListeners(t, l, 2)
+	send(t, l, waitloop.Event{Key: "a"})
+
+	advance(t, l, clock, 2*time.Minute)
+	if err := groupResult(t, result); err != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", err)
+	}
+}
+
+func TestWaitGroupContextEventError(t *testing.T) {
+	l := newLoop(t, nil)
+	failed := context.DeadlineExceeded
+	result := waitGroup(context.Background(), l, "a", "b")
+	waitListeners(t, l, 2)
+	send(t, l, waitloop.Event{Key: "b", Error: failed})
+	if err := groupResult(t, result); err != failed {
+		t.Fatalf("got %v, want the event's error", err)
+	}
+}
+
+func TestWaitGroupContextCancel(t *testing.T) {
+	l := newLoop(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	result := waitGroup(ctx, l, "a", "b")
+	waitListeners(t, l, 2)
+	send(t, l, waitloop.Event{Key: "a"})
+
+	cancel()
+	if err := groupResult(t, result); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	// The listener still waiting is removed
+	waitListeners(t, l, 0)
+}
+
+func TestWaitGroupContextTerminate(t *testing.T) {
+	l := newLoop(t, nil)
+	result := waitGroup(context.Background(), l, "a")
+	waitListeners(t, l, 1)
+	l.Terminate()
+	if err := groupResult(t, result); err != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", err)
+	}
+}
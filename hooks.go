@@ -0,0 +1,71 @@
+package waitloop
+
+import "time"
+
+// WaitWithTimeoutKey is WaitTTL, except that if the wait times out the loop also sends an event to
+// timeoutKey whose Data is the original key, for dead-letter style handling
+func (l *Loop) WaitWithTimeoutKey(key, timeoutKey string, ttl time.Duration) <-chan Event {
+	return l.waitHooked(key, ttl, func(e Event) {
+		if e.Error == ErrTimedOut {
+			go l.Send(Event{Key: timeoutKey, Data: key})
+		}
+	})
+}
+
+// WaitWithTimeoutAction is WaitTTL, and also runs onTimeout on its own goroutine if the wait times
+// out; the channel still receives the ErrTimedOut Event
+func (l *Loop) WaitWithTimeoutAction(key string, ttl time.Duration, onTimeout func()) <-chan Event {
+	return l.waitHooked(key, ttl, func(e Event) {
+		if e.Error == ErrTimedOut {
+			l.spawn(onTimeout)
+		}
+	})
+}
+
+// WaitWithCleanup is Wait, and also runs cleanup exactly once with the listener's final event,
+// whatever the outcome (event, timeout, termination or cancellation), on its own goroutine
+func (l *Loop) WaitWithCleanup(key string, cleanup func(Event)) <-chan Event {
+	return l.waitHooked(key, 0, func(e Event) {
+		l.spawn(func() { cleanup(e) })
+	})
+}
+
+// WaitWithRemoveHook is Wait, and also calls onRemove exactly once when the listener is removed,
+// with the reason: nil if it fired, or the error it ended with (timeout, cancellation,
+// termination). onRemove runs on the run goroutine, so it must not block
+func (l *Loop) WaitWithRemoveHook(key string, onRemove func(error)) <-chan Event {
+	return l.waitHooked(key, 0, func(e Event) { onRemove(e.Error) })
+}
+
+// waitHooked registers a listener, with ttl as for WaitTTL, whose final event is passed to hook
+// before it is sent on the returned channel; hook normally runs on the run goroutine, so it must
+// not block. Any setup funcs adjust the listener before it is registered
+func (l *Loop) waitHooked(key string, ttl time.Duration, hook func(Event), setup ...func(*listener)) <-chan Event {
+	out := make(chan Event, 1)
+	lis := l.waitListener(key, ttl)
+	lis.Handler = func(e Event) {
+		hook(e)
+		l.send(out, e)
+	}
+	for _, fn := range setup {
+		fn(&lis)
+	}
+	l.register(lis)
+	return out
+}
+
+// WaitFanOut registers a single listener on key and passes its Event to every handler, each on its
+// own goroutine; a handler that panics is recovered without affecting the others
+func (l *Loop) WaitFanOut(key string, handlers ...func(Event)) {
+	lis := l.waitListener(key, 0)
+	lis.Handler = func(e Event) {
+		for _, h := range handlers {
+			h := h
+			l.spawn(func() {
+				defer func() { recover() }()
+				h(e)
+			})
+		}
+	}
+	l.register(lis)
+}
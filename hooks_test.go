@@ -0,0 +1,232 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+	"github.com/fsufitch/waitloop/fakeclock"
+)
+
+func TestWaitWithTimeoutKeyNotifiesTheTimeoutKey(t *testing.T) {
+	l, clock := newFakeLoop(t, nil)
+	dead := l.WaitTTL("dead", time.Hour)
+	ch := l.WaitWithTimeoutKey("key", "dead", time.Minute)
+	waitListeners(t, l, 2)
+
+	advance(t, l, clock, 2*time.Minute)
+	if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+	if e := recv(t, dead); e.Data != "key" {
+		t.Fatalf("timeout key got %v, want the original key", e.Data)
+	}
+}
+
+func TestWaitWithTimeoutKeyFired(t *testing.T) {
+	l, clock := newFakeLoop(t, nil)
+	dead := l.WaitTTL("dead", time.Hour)
+	ch := l.WaitWithTimeoutKey("key", "dead", time.Minute)
+	waitListeners(t, l, 2)
+
+	send(t, l, waitloop.Event{Key: "key"})
+	recv(t, ch)
+	advance(t, l, clock, 2*time.Minute)
+	noRecv(t, dead)
+}
+
+func TestWaitFanOutRunsEveryHandlerWithTheEvent(t *testing.T) {
+	l := newLoop(t, nil)
+	got := make(chan waitloop.Event, 3)
+	handler := func(e waitloop.Event) { got <- e }
+	l.WaitFanOut("key", handler, handler, handler)
+	waitListeners(t, l, 1)
+
+	if n := send(t, l, waitloop.Event{Key: "key", Data: 7}); n != 1 {
+		t.Fatalf("event reached %d listeners, want one for all the handlers", n)
+	}
+	for i := 0; i < 3; i++ {
+		if e := recv(t, got); e.Data != 7 {
+			t.Fatalf("handler %d got %v, want 7", i, e.Data)
+		}
+	}
+	waitListeners(t, l, 0)
+}
+
+func TestWaitFanOutRecoversEachHandler(t *testing.T) {
+	l := newLoop(t, nil)
+	got := make(chan waitloop.Event, 2)
+	handler := func(e waitloop.Event) { got <- e }
+	l.WaitFanOut("key", handler, func(waitloop.Event) { panic("handler failed") }, handler)
+	waitListeners(t, l, 1)
+
+	send(t, l, waitloop.Event{Key: "key"})
+	recv(t, got)
+	recv(t, got)
+	waitUntil(t, "the handlers to finish", func() bool { return l.ActiveDeliveries() == 0 })
+	if !l.Ping(patience) {
+		t.Fatal("loop stopped after a handler panicked")
+	}
+}
+
+func TestWaitWithCleanupRunsOnceForEachEnding(t *testing.T) {
+	endings := []struct {
+		name string
+		end  func(l *waitloop.Loop, clock *fakeclock.Clock)
+		want error
+	}{
+		{"event", func(l *waitloop.Loop, _ *fakeclock.Clock) { l.Send(waitloop.Event{Key: "key"}) }, nil},
+		{"timeout", func(l *waitloop.Loop, clock *fakeclock.Clock) { clock.Advance(2 * time.Minute) }, waitloop.ErrTimedOut},
+		{"terminate", func(l *waitloop.Loop, _ *fakeclock.Clock) { l.Terminate() }, waitloop.ErrLoopTerminated},
+		{"cancel", func(l *waitloop.Loop, _ *fakeclock.Clock) { l.Cancel("key") }, waitloop.ErrCanceled},
+	}
+	for _, ending := range endings {
+		t.Run(ending.name, func(t *testing.T) {
+			l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+			cleanups := make(chan waitloop.Event, 2)
+			ch := l.WaitWithCleanup("key", func(e waitloop.Event) { cleanups <- e })
+			waitListeners(t, l, 1)
+
+			ending.end(l, clock)
+			if e := recv(t, ch); e.Error != ending.want {
+				t.Fatalf("got %v, want %v", e.Error, ending.want)
+			}
+			if e := recv(t, cleanups); e.Error != ending.want {
+				t.Fatalf("cleanup got %v, want %v", e.Error, ending.want)
+			}
+
+			// Nothing that happens afterwards runs it again
+			l.Send(waitloop.Event{Key: "key"})
+			l.Cancel("key")
+			l.Terminate()
+			stopped(t, l)
+			waitUntil(t, "deliveries to finish", func() bool { return l.ActiveDeliveries() == 0 })
+			noRecv(t, cleanups)
+		})
+	}
+}
+
+func TestWaitWithRemoveHookRunsOnceWithTheReason(t *testing.T) {
+	endings := []struct {
+		name string
+		end  func(l *waitloop.Loop, clock *fakeclock.Clock)
+		want error
+	}{
+		{"fired", func(l *waitloop.Loop, _ *fakeclock.Clock) { l.Send(waitloop.Event{Key: "key"}) }, nil},
+		{"timed out", func(l *waitloop.Loop, clock *fakeclock.Clock) { clock.Advance(2 * time.Minute) }, waitloop.ErrTimedOut},
+		{"cancelled", func(l *waitloop.Loop, _ *fakeclock.Clock) { l.Cancel("key") }, waitloop.ErrCanceled},
+		{"terminated", func(l *waitloop.Loop, _ *fakeclock.Clock) { l.Terminate() }, waitloop.ErrLoopTerminated},
+	}
+	for _, ending := range endings {
+		t.Run(ending.name, func(t *testing.T) {
+			l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+			reasons := make(chan error, 2)
+			ch := l.WaitWithRemoveHook("key", func(err error) { reasons <- err })
+			waitListeners(t, l, 1)
+
+			ending.end(l, clock)
+			select {
+			case err := <-reasons:
+				if err != ending.want {
+					t.Fatalf("got reason %v, want %v", err, ending.want)
+				}
+			case <-time.After(patience):
+				t.Fatal("onRemove was not called")
+			}
+			recv(t, ch)
+			closed(t, ch)
+
+			l.Send(waitloop.Event{Key: "key"})
+			l.Cancel("key")
+			l.Terminate()
+			stopped(t, l)
+			select {
+			case err := <-reasons:
+				t.Fatalf("onRemove called again with %v", err)
+			default:
+			}
+		})
+	}
+}
+
+func TestOnFireReportsEachKeyAndCount(t *testing.T) {
+	type fire struct {
+		key      string
+		notified int
+	}
+	var fires []fire
+	// OnFire runs on the run goroutine before the event is acknowledged, so send orders these reads
+	l := newLoop(t, &waitloop.LoopOptions{OnFire: func(key string, notified int) {
+		fires = append(fires, fire{key, notified})
+	}})
+	l.Wait("a")
+	l.Wait("a")
+	l.Wait("b")
+	waitListeners(t, l, 3)
+
+	send(t, l, waitloop.Event{Key: "a"})
+	send(t, l, waitloop.Event{Key: "none"})
+	send(t, l, waitloop.Event{Key: "b"})
+	send(t, l, waitloop.Event{Key: "a"})
+	want := []fire{{"a", 2}, {"b", 1}}
+	if len(fires) != len(want) {
+		t.Fatalf("got %v, want %v", fires, want)
+	}
+	for i := range want {
+		if fires[i] != want[i] {
+			t.Fatalf("got %v, want %v", fires, want)
+		}
+	}
+}
+
+func TestWaitWithTimeoutActionRunsOnTimeout(t *testing.T) {
+	l, clock := newFakeLoop(t, nil)
+	ran := make(chan struct{}, 2)
+	ch := l.WaitWithTimeoutAction("key", time.Minute, func() { ran <- struct{}{} })
+	waitListeners(t, l, 1)
+
+	advance(t, l, clock, 2*time.Minute)
+	if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+	select {
+	case <-ran:
+	case <-time.After(patience):
+		t.Fatal("onTimeout did not run")
+	}
+	waitUntil(t, "onTimeout to return", func() bool { return l.ActiveDeliveries() == 0 })
+	if len(ran) != 0 {
+		t.Fatal("onTimeout ran more than once")
+	}
+}
+
+func TestWaitWithTimeoutActionSkippedWhenFired(t *testing.T) {
+	for _, end := range []struct {
+		name string
+		do   func(*waitloop.Loop)
+	}{
+		{"fired", func(l *waitloop.Loop) { send(t, l, waitloop.Event{Key: "key"}) }},
+		{"cancelled", func(l *waitloop.Loop) { l.Cancel("key") }},
+		{"terminated", func(l *waitloop.Loop) { l.Terminate() }},
+	} {
+		t.Run(end.name, func(t *testing.T) {
+			l, clock := newFakeLoop(t, nil)
+			ran := make(chan struct{}, 1)
+			ch := l.WaitWithTimeoutAction("key", time.Minute, func() { ran <- struct{}{} })
+			waitListeners(t, l, 1)
+
+			end.do(l)
+			for range ch {
+			}
+			// Had the listener outlived this, it would have timed out
+			if end.name != "terminated" {
+				advance(t, l, clock, 2*time.Minute)
+			}
+			select {
+			case <-ran:
+				t.Fatal("onTimeout ran without a timeout")
+			case <-time.After(20 * time.Millisecond):
+			}
+		})
+	}
+}
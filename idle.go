@@ -0,0 +1,86 @@
+package waitloop
+
+import "context"
+
+// AwaitKeyIdle blocks until key has no registered listeners (they all fired, expired or were
+// cancelled), or until ctx is done, in which case it returns ctx.Err()
+func (l *Loop) AwaitKeyIdle(ctx context.Context, key string) error {
+	idle := make(chan struct{})
+	if !l.exec(func() { l.watchIdle(key, idle) }) {
+		return nil
+	}
+
+	select {
+	case <-idle:
+		return nil
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		l.exec(func() { l.unwatchIdle(key, idle) })
+		return ctx.Err()
+	}
+}
+
+func (l *Loop) watchIdle(key string, idle chan struct{}) {
+	if _, ok := l.listenerMap[key]; !ok {
+		close(idle)
+		return
+	}
+	l.idleWatchers[key] = append(l.idleWatchers[key], idle)
+}
+
+func (l *Loop) unwatchIdle(key string, idle chan struct{}) {
+	watchers := l.idleWatchers[key]
+	for i, w := range watchers {
+		if w == idle {
+			l.idleWatchers[key] = append(watchers[:i:i], watchers[i+1:]...)
+			break
+		}
+	}
+	if len(l.idleWatchers[key]) == 0 {
+		delete(l.idleWatchers, key)
+	}
+}
+
+// notifyIdle releases AwaitKeyIdle callers whose key has emptied
+func (l *Loop) notifyIdle() {
+	for key, watchers := range l.idleWatchers {
+		if _, ok := l.listenerMap[key]; ok {
+			continue
+		}
+		for _, w := range watchers {
+			close(w)
+		}
+		delete(l.idleWatchers, key)
+	}
+}
+
+// CleanupResult describes one cleanup pass
+type CleanupResult struct {
+	// TimedOut is how many listeners the pass expired
+	TimedOut int
+
+	// TimedOutByKey breaks TimedOut down by key, one count per key that had listeners expire
+	TimedOutByKey map[string]int
+
+	// Remaining is how many listeners were still registered after it
+	Remaining int
+}
+
+// WaitNextCleanup blocks until the next cleanup pass has finished and returns its result, or
+// returns ctx.Err() or ErrLoopTerminated if that happens first
+func (l *Loop) WaitNextCleanup(ctx context.Context) (CleanupResult, error) {
+	result := make(chan CleanupResult, 1)
+	if !l.exec(func() { l.cleanupWatchers = append(l.cleanupWatchers, result) }) {
+		return CleanupResult{}, ErrLoopTerminated
+	}
+
+	select {
+	case r := <-result:
+		return r, nil
+	case <-l.done:
+		return CleanupResult{}, ErrLoopTerminated
+	case <-ctx.Done():
+		return CleanupResult{}, ctx.Err()
+	}
+}
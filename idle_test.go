@@ -0,0 +1,183 @@
+package waitloop_test
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// awaitKeyIdle calls AwaitKeyIdle on its own goroutine, returning its result
+func awaitKeyIdle(ctx context.Context, l *waitloop.Loop, key string) <-chan error {
+	result := make(chan error, 1)
+	go func() { result <- l.AwaitKeyIdle(ctx, key) }()
+	return result
+}
+
+func TestAwaitKeyIdleReturnsOnceListenersAreGone(t *testing.T) {
+	l := newLoop(t, nil)
+	a, b := l.Wait("key"), l.Wait("key")
+	other := l.Wait("other")
+	waitListeners(t, l, 3)
+
+	result := awaitKeyIdle(context.Background(), l, "key")
+	select {
+	case err := <-result:
+		t.Fatalf("returned %v while the key had listeners", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	send(t, l, waitloop.Event{Key: "key"})
+	recv(t, a)
+	recv(t, b)
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(patience):
+		t.Fatal("AwaitKeyIdle did not return once the key was idle")
+	}
+	noRecv(t, other)
+}
+
+func TestAwaitKeyIdleOnAnIdleKey(t *testing.T) {
+	l := newLoop(t, nil)
+	if err := l.AwaitKeyIdle(context.Background(), "key"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAwaitKeyIdleHonoursContext(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Wait("key")
+	waitListeners(t, l, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.AwaitKeyIdle(ctx, "key"); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// waitNextCleanup calls WaitNextCleanup on its own goroutine, returning its result once the loop
+// has taken the request
+func waitNextCleanup(t *testing.T, l *waitloop.Loop) <-chan waitloop.CleanupResult {
+	t.Helper()
+	result := make(chan waitloop.CleanupResult, 1)
+	go func() {
+		r, err := l.WaitNextCleanup(context.Background())
+		if err == nil {
+			result <- r
+		}
+	}()
+	// The request is registered once WaitNextCleanup itself, rather than anything it calls, is
+	// what the goroutine is blocked in
+	waitUntil(t, "WaitNextCleanup to register", func() bool {
+		buf := make([]byte, 1<<20)
+		stacks := string(buf[:runtime.Stack(buf, true)])
+		return strings.Contains(stacks, "[select]:\ngithub.com/fsufitch/waitloop.(*Loop).WaitNextCleanup(")
+	})
+	return result
+}
+
+func TestWaitNextCleanupReportsExpirations(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, CleanupInterval: time.Hour})
+	l.Wait("a")
+	l.Wait("a")
+	l.Wait("b")
+	l.WaitTTL("c", 2*time.Hour)
+	waitListeners(t, l, 4)
+
+	result := waitNextCleanup(t, l)
+	advance(t, l, clock, time.Hour)
+	select {
+	case r := <-result:
+		if r.TimedOut != 3 || r.TimedOutByKey["a"] != 2 || r.TimedOutByKey["b"] != 1 || r.Remaining != 1 {
+			t.Fatalf("got %+v, want a and b timed out with c remaining", r)
+		}
+	case <-time.After(patience):
+		t.Fatal("WaitNextCleanup did not return after a cleanup pass")
+	}
+}
+
+func TestWaitNextCleanupWaitsForThePass(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{CleanupInterval: time.Hour})
+	result := waitNextCleanup(t, l)
+	advance(t, l, clock, time.Minute)
+	select {
+	case r := <-result:
+		t.Fatalf("returned %+v before a cleanup pass", r)
+	case <-time.After(20 * time.Millisecond):
+	}
+	advance(t, l, clock, time.Hour)
+	select {
+	case r := <-result:
+		if r.TimedOut != 0 || r.Remaining != 0 {
+			t.Fatalf("got %+v from an empty pass", r)
+		}
+	case <-time.After(patience):
+		t.Fatal("WaitNextCleanup did not return after a cleanup pass")
+	}
+}
+
+func TestWaitNextCleanupContext(t *testing.T) {
+	l, _ := newFakeLoop(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.WaitNextCleanup(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWaitNextCleanupTerminate(t *testing.T) {
+	l, _ := newFakeLoop(t, nil)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		l.Terminate()
+	}()
+	if _, err := l.WaitNextCleanup(context.Background()); err != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", err)
+	}
+	if _, err := l.WaitNextCleanup(context.Background()); err != waitloop.ErrLoopTerminated {
+		t.Fatalf("after termination got %v, want ErrLoopTerminated", err)
+	}
+}
+
+func TestCleanupResultCountsTimeoutsPerKeyPerPass(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, CleanupInterval: time.Hour})
+	for i := 0; i < 3; i++ {
+		l.Wait("a")
+	}
+	l.Wait("b")
+	l.WaitPrefix("p/")
+	l.WaitTTL("c", 90*time.Minute)
+	l.WaitTTL("c", 90*time.Minute)
+	waitListeners(t, l, 7)
+
+	passes := []map[string]int{
+		{"a": 3, "b": 1, "p/": 1},
+		{"c": 2},
+		{},
+	}
+	for i, want := range passes {
+		total := 0
+		for _, n := range want {
+			total += n
+		}
+		result := waitNextCleanup(t, l)
+		advance(t, l, clock, time.Hour)
+		select {
+		case r := <-result:
+			if !reflect.DeepEqual(r.TimedOutByKey, want) || r.TimedOut != total {
+				t.Fatalf("pass %d got %+v, want %v", i, r, want)
+			}
+		case <-time.After(patience):
+			t.Fatalf("pass %d did not report", i)
+		}
+	}
+}
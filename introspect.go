@@ -0,0 +1,330 @@
+package waitloop
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// SnapshotTo sends ch one Event whose Data is the sorted []string of keys that have listeners,
+// taken on the run goroutine at the moment the request is handled; ch is not closed
+func (l *Loop) SnapshotTo(ch chan<- Event) {
+	ok := l.exec(func() {
+		keys := make([]string, 0, len(l.listenerMap))
+		for key := range l.listenerMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		l.spawn(func() { ch <- Event{Data: keys} })
+	})
+	if !ok {
+		go func() { ch <- Event{Error: ErrLoopTerminated} }()
+	}
+}
+
+// ListenerInfo describes a registered listener
+type ListenerInfo struct {
+	Key        string
+	Registered time.Time
+	Expiration time.Time
+	Priority   int
+}
+
+func (lis listener) info() ListenerInfo {
+	return ListenerInfo{
+		Key:        lis.Key,
+		Registered: lis.Registered,
+		Expiration: lis.Expiration,
+		Priority:   lis.Priority,
+	}
+}
+
+// SendWhere sends data on key only to the listeners for which pred returns true, and returns how
+// many were notified; the others keep waiting. pred runs on the run goroutine and must not block;
+// a listener for which it panics is left waiting, as if it had returned false.
+// An event rejected by LoopOptions.Validate notifies no one; one on a paused key is held like any
+// other, and returns 0
+func (l *Loop) SendWhere(key string, data interface{}, pred func(ListenerInfo) bool) int {
+	e := Event{Key: key, Data: data}
+	if l.check(e) != nil {
+		return 0
+	}
+	match := func(lis listener) (ok bool) {
+		defer func() {
+			if recover() != nil {
+				ok = false
+			}
+		}()
+		return pred(lis.info())
+	}
+	count := make(chan int, 1)
+	ok := l.exec(func() {
+		// Counted even if a hook panics, reporting whatever was notified before it did
+		notified := 0
+		defer func() { count <- notified }()
+		notified = l.dispatch(sentEvent{event: e, match: match})
+	})
+	if !ok {
+		atomic.AddUint64(&l.counters.dropped, 1)
+		return 0
+	}
+	atomic.AddUint64(&l.counters.sent, 1)
+	return <-count
+}
+
+// ListenerID identifies one listener, as returned by WaitWithID
+type ListenerID uint64
+
+// ListenerStatus describes a listener, live or recently finished
+type ListenerStatus struct {
+	ListenerInfo
+	ID ListenerID
+
+	// Done is set once the listener has received its final event
+	Done bool
+
+	// Delivered is set if that final event was a normal one
+	Delivered bool
+
+	// Err is the final event's error, such as ErrTimedOut, if it had one
+	Err error
+}
+
+type finishedListener struct {
+	status ListenerStatus
+	at     time.Time
+}
+
+func (lis listener) status(done bool, err error) ListenerStatus {
+	return ListenerStatus{
+		ListenerInfo: lis.info(),
+		ID:           ListenerID(lis.ID),
+		Done:         done,
+		Delivered:    done && err == nil,
+		Err:          err,
+	}
+}
+
+// WaitWithID is Wait, also returning an id with which the listener can be inspected
+func (l *Loop) WaitWithID(key string) (<-chan Event, ListenerID) {
+	lis := l.waitListener(key, 0)
+	lis.Tracked = true
+	l.register(lis)
+	return lis.Channel, ListenerID(lis.ID)
+}
+
+// Inspect looks up a listener registered with WaitWithID; finished listeners are remembered for
+// one TTL after they finish
+func (l *Loop) Inspect(id ListenerID) (ListenerStatus, bool) {
+	type result struct {
+		status ListenerStatus
+		ok     bool
+	}
+	found := make(chan result, 1)
+	ok := l.exec(func() {
+		status, ok := l.lookup(uint64(id))
+		found <- result{status, ok}
+	})
+	if !ok {
+		return ListenerStatus{}, false
+	}
+	r := <-found
+	return r.status, r.ok
+}
+
+// RemainingTTL reports how long until a listener registered with WaitWithID expires; it returns
+// false once the listener is no longer registered
+func (l *Loop) RemainingTTL(id ListenerID) (time.Duration, bool) {
+	status, ok := l.Inspect(id)
+	if !ok || status.Done {
+		return 0, false
+	}
+	remaining := status.Expiration.Sub(l.now())
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+func (l *Loop) lookup(id uint64) (ListenerStatus, bool) {
+	if f, ok := l.finished[id]; ok {
+		return f.status, true
+	}
+	for _, listeners := range l.listenerMap {
+		for _, lis := range listeners {
+			if lis.ID == id {
+				return lis.status(false, nil), true
+			}
+		}
+	}
+	return ListenerStatus{}, false
+}
+
+func (l *Loop) pruneFinished(before time.Time) {
+	for id, f := range l.finished {
+		if f.at.Before(before) {
+			delete(l.finished, id)
+		}
+	}
+}
+
+// Preview reports the listeners that sending an event on key would notify right now, without
+// delivering anything or removing them; prefix listeners that match key follow those on key
+// itself, in the order they would fire
+func (l *Loop) Preview(key string) []ListenerStatus {
+	found := make(chan []ListenerStatus, 1)
+	ok := l.exec(func() {
+		now := l.now()
+		notified, _ := l.route(l.listenerMap[key], now, nil)
+		for i := 0; i <= len(key) && len(l.prefixMap) > 0; i++ {
+			prefixed, _ := l.route(l.prefixMap[key[:i]], now, nil)
+			notified = append(notified, prefixed...)
+		}
+		statuses := make([]ListenerStatus, len(notified))
+		for i, lis := range notified {
+			statuses[i] = lis.status(false, nil)
+		}
+		found <- statuses
+	})
+	if !ok {
+		return nil
+	}
+	return <-found
+}
+
+// Broadcast delivers data to every listener on every key, as if an event had been sent on each of
+// them; unlike Terminate, the loop keeps running and new waits can register afterwards
+// LoopOptions.Validate sees it once, as an Event with data and no key, and an error it returns is
+// passed back without anything being delivered; on a loop that is down it returns ErrLoopTerminated
+func (l *Loop) Broadcast(data interface{}) error {
+	if err := l.check(Event{Data: data}); err != nil {
+		return err
+	}
+	all := func(listener) bool { return true }
+	ok := l.exec(func() {
+		for _, key := range sortedKeys(l.listenerMap) {
+			l.dispatch(sentEvent{event: Event{Key: key, Data: data}, match: all})
+		}
+		// Prefix listeners that no key's event reached, without repeating it for the others
+		for _, prefix := range sortedKeys(l.prefixMap) {
+			prefix := prefix
+			only := func(lis listener) bool { return lis.Prefix && lis.Key == prefix }
+			l.dispatch(sentEvent{event: Event{Key: prefix, Data: data}, match: only})
+		}
+	})
+	if !ok {
+		return ErrLoopTerminated
+	}
+	atomic.AddUint64(&l.counters.sent, 1)
+	return nil
+}
+
+// DrainListeners removes every registered listener, first passing each one to fn along with its
+// key, and then cancelling it with ErrCanceled; fn runs on the run goroutine and must not block
+func (l *Loop) DrainListeners(fn func(key string, status ListenerStatus)) {
+	l.exec(func() {
+		var all []listener
+		for _, key := range sortedKeys(l.listenerMap) {
+			all = append(all, l.listenerMap[key]...)
+		}
+		for _, prefix := range sortedKeys(l.prefixMap) {
+			all = append(all, l.prefixMap[prefix]...)
+		}
+		l.listenerMap = map[string][]listener{}
+		l.prefixMap = map[string][]listener{}
+		atomic.StoreInt64(&l.counters.listeners, 0)
+
+		for _, lis := range all {
+			fn(lis.Key, lis.status(false, nil))
+			l.deliver(lis, Event{Key: lis.Key, Error: ErrCanceled})
+		}
+	})
+}
+
+func sortedKeys(listeners map[string][]listener) []string {
+	keys := make([]string, 0, len(listeners))
+	for key := range listeners {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SubscriptionKind is the kind of wait behind a registered listener
+type SubscriptionKind int
+
+const (
+	// SubscriptionWait is a one-shot wait on a single key, such as Wait or WaitTTL
+	SubscriptionWait SubscriptionKind = iota
+	// SubscriptionWorker is a worker listener registered with WaitWork
+	SubscriptionWorker
+	// SubscriptionPrefix is a wait on every key with a prefix, registered with WaitPrefix
+	SubscriptionPrefix
+	// SubscriptionPersistent is a subscription that receives every event, such as SubscribeSet
+	SubscriptionPersistent
+	// SubscriptionGroup is one key of a wait on several, such as WaitAny, WaitAll or WaitUnless
+	SubscriptionGroup
+)
+
+func (k SubscriptionKind) String() string {
+	switch k {
+	case SubscriptionWait:
+		return "wait"
+	case SubscriptionWorker:
+		return "worker"
+	case SubscriptionPrefix:
+		return "prefix"
+	case SubscriptionPersistent:
+		return "persistent"
+	case SubscriptionGroup:
+		return "group"
+	}
+	return "unknown"
+}
+
+// SubscriptionInfo describes one registered listener, as reported by Subscriptions
+type SubscriptionInfo struct {
+	ListenerInfo
+	ID   ListenerID
+	Kind SubscriptionKind
+}
+
+func (lis listener) kind() SubscriptionKind {
+	switch {
+	case lis.Persistent:
+		return SubscriptionPersistent
+	case lis.Group:
+		return SubscriptionGroup
+	case lis.Prefix:
+		return SubscriptionPrefix
+	case lis.Worker:
+		return SubscriptionWorker
+	}
+	return SubscriptionWait
+}
+
+// Subscriptions lists every registered listener with its kind, ordered by key, with prefix
+// listeners last; for those Key is the prefix, and persistent ones never expire, so their
+// Expiration is zero
+func (l *Loop) Subscriptions() []SubscriptionInfo {
+	found := make(chan []SubscriptionInfo, 1)
+	ok := l.exec(func() {
+		var subs []SubscriptionInfo
+		for _, listeners := range []map[string][]listener{l.listenerMap, l.prefixMap} {
+			for _, key := range sortedKeys(listeners) {
+				for _, lis := range listeners[key] {
+					subs = append(subs, SubscriptionInfo{
+						ListenerInfo: lis.info(),
+						ID:           ListenerID(lis.ID),
+						Kind:         lis.kind(),
+					})
+				}
+			}
+		}
+		found <- subs
+	})
+	if !ok {
+		return nil
+	}
+	return <-found
+}
@@ -0,0 +1,390 @@
+package waitloop_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// snapshot asks l for its pending keys
+func snapshot(t *testing.T, l *waitloop.Loop) waitloop.Event {
+	t.Helper()
+	ch := make(chan waitloop.Event)
+	l.SnapshotTo(ch)
+	return recv(t, ch)
+}
+
+func TestSnapshotToReportsPendingKeys(t *testing.T) {
+	l := newLoop(t, nil)
+	if e := snapshot(t, l); !reflect.DeepEqual(e.Data, []string{}) {
+		t.Fatalf("got %#v, want no keys", e.Data)
+	}
+
+	l.Wait("b")
+	l.Wait("a")
+	l.Wait("b")
+	waitListeners(t, l, 3)
+	if e := snapshot(t, l); !reflect.DeepEqual(e.Data, []string{"a", "b"}) {
+		t.Fatalf("got %#v, want a and b", e.Data)
+	}
+
+	send(t, l, waitloop.Event{Key: "a"})
+	if e := snapshot(t, l); !reflect.DeepEqual(e.Data, []string{"b"}) {
+		t.Fatalf("got %#v, want just b", e.Data)
+	}
+}
+
+func TestSnapshotToTerminatedLoop(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Terminate()
+	stopped(t, l)
+	if e := snapshot(t, l); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+}
+
+func TestSendWhereReachesOnlyMatchingListeners(t *testing.T) {
+	l := newLoop(t, nil)
+	high := l.WaitPriority("key", 5)
+	low := l.WaitPriority("key", 1)
+	plain := l.Wait("key")
+	other := l.WaitPriority("other", 5)
+	waitListeners(t, l, 4)
+
+	n := l.SendWhere("key", "urgent", func(info waitloop.ListenerInfo) bool { return info.Priority >= 5 })
+	if n != 1 {
+		t.Fatalf("notified %d listeners, want 1", n)
+	}
+	if e := recv(t, high); e.Data != "urgent" {
+		t.Fatalf("got %v, want urgent", e.Data)
+	}
+	noRecv(t, low)
+	noRecv(t, plain)
+	noRecv(t, other)
+	waitListeners(t, l, 3)
+
+	// The others are still there for an ordinary send
+	if n := send(t, l, waitloop.Event{Key: "key", Data: "all"}); n != 2 {
+		t.Fatalf("notified %d listeners, want 2", n)
+	}
+	recv(t, low)
+	recv(t, plain)
+}
+
+func TestSendWhereByRegistrationTime(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Hour})
+	old := l.Wait("key")
+	waitListeners(t, l, 1)
+	clock.Advance(time.Minute)
+	young := l.Wait("key")
+	waitListeners(t, l, 2)
+
+	cutoff := clock.Now().Add(-30 * time.Second)
+	n := l.SendWhere("key", nil, func(info waitloop.ListenerInfo) bool { return info.Registered.Before(cutoff) })
+	if n != 1 {
+		t.Fatalf("notified %d listeners, want 1", n)
+	}
+	recv(t, old)
+	noRecv(t, young)
+}
+
+func TestSendWhereNoMatch(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+	if n := l.SendWhere("key", nil, func(waitloop.ListenerInfo) bool { return false }); n != 0 {
+		t.Fatalf("notified %d listeners, want 0", n)
+	}
+	noRecv(t, ch)
+	if n := l.SendWhere("missing", nil, func(waitloop.ListenerInfo) bool { return true }); n != 0 {
+		t.Fatalf("notified %d listeners on a key without any, want 0", n)
+	}
+}
+
+func TestInspectTracksTheListener(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	start := clock.Now()
+	ch, id := l.WaitWithID("key")
+	waitListeners(t, l, 1)
+
+	status, ok := l.Inspect(id)
+	if !ok {
+		t.Fatal("listener not found")
+	}
+	if status.ID != id || status.Key != "key" || !status.Registered.Equal(start) ||
+		!status.Expiration.Equal(start.Add(time.Minute)) || status.Done || status.Delivered || status.Err != nil {
+		t.Fatalf("got %+v for a waiting listener", status)
+	}
+
+	send(t, l, waitloop.Event{Key: "key"})
+	recv(t, ch)
+	status, ok = l.Inspect(id)
+	if !ok || !status.Done || !status.Delivered || status.Err != nil || status.Key != "key" {
+		t.Fatalf("got %+v, %v for a listener that fired", status, ok)
+	}
+}
+
+func TestInspectExpiredListener(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	ch, id := l.WaitWithID("key")
+	waitListeners(t, l, 1)
+	advance(t, l, clock, 2*time.Minute)
+	recv(t, ch)
+
+	status, ok := l.Inspect(id)
+	if !ok || !status.Done || status.Delivered || status.Err != waitloop.ErrTimedOut {
+		t.Fatalf("got %+v, %v for a listener that timed out", status, ok)
+	}
+
+	// Finished listeners are forgotten a TTL later
+	advance(t, l, clock, 2*time.Minute)
+	if _, ok := l.Inspect(id); ok {
+		t.Fatal("finished listener still found after a TTL")
+	}
+}
+
+func TestInspectUnknownID(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Wait("key")
+	waitListeners(t, l, 1)
+	if _, ok := l.Inspect(12345); ok {
+		t.Fatal("found a listener that was never registered")
+	}
+}
+
+func TestPreviewMatchesTheNextSend(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, CleanupInterval: time.Hour})
+	stale, staleID := l.WaitWithID("key")
+	waitListeners(t, l, 1)
+	clock.Advance(45 * time.Second)
+	fresh, freshID := l.WaitWithID("key")
+	l.WaitWork("key", 1)
+	l.WaitWork("key", 3)
+	l.Wait("other")
+	waitListeners(t, l, 5)
+	// The first listener is past its TTL, though cleanup has not removed it yet
+	clock.Advance(30 * time.Second)
+
+	preview := l.Preview("key")
+	if len(preview) != 2 || preview[0].ID != freshID || preview[1].Priority != 3 {
+		t.Fatalf("got %+v, want the fresh listener and the higher priority worker", preview)
+	}
+	if again := l.Preview("key"); !reflect.DeepEqual(again, preview) {
+		t.Fatalf("second preview %+v differs from the first %+v", again, preview)
+	}
+	waitListeners(t, l, 5)
+
+	if n := send(t, l, waitloop.Event{Key: "key"}); n != len(preview) {
+		t.Fatalf("send notified %d listeners, preview listed %d", n, len(preview))
+	}
+	recv(t, fresh)
+	noRecv(t, stale)
+	if status, _ := l.Inspect(staleID); status.Done {
+		t.Fatalf("stale listener got %+v", status)
+	}
+}
+
+func TestPreviewIncludesPrefixListeners(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Wait("user.1")
+	l.WaitPrefix("user.")
+	l.WaitPrefix("order.")
+	waitListeners(t, l, 3)
+
+	if preview := l.Preview("user.2"); len(preview) != 1 || preview[0].Key != "user." {
+		t.Fatalf("got %+v, want just the prefix listener", preview)
+	}
+	preview := l.Preview("user.1")
+	if len(preview) != 2 || preview[0].Key != "user.1" || preview[1].Key != "user." {
+		t.Fatalf("got %+v, want the listener on the key and then the prefix listener", preview)
+	}
+	if n := send(t, l, waitloop.Event{Key: "user.1"}); n != len(preview) {
+		t.Fatalf("send notified %d listeners, preview listed %d", n, len(preview))
+	}
+}
+
+func TestPreviewEmptyKey(t *testing.T) {
+	l := newLoop(t, nil)
+	if preview := l.Preview("key"); len(preview) != 0 {
+		t.Fatalf("got %+v for a key without listeners", preview)
+	}
+}
+
+func TestDrainListenersHandsOffEveryListener(t *testing.T) {
+	l := newLoop(t, nil)
+	chans := []<-chan waitloop.Event{l.Wait("b"), l.Wait("a"), l.Wait("b"), l.WaitPrefix("p/")}
+	sub, cancel := l.SubscribeSet([]string{"s"})
+	defer cancel()
+	waitListeners(t, l, 5)
+
+	var drained []string
+	l.DrainListeners(func(key string, status waitloop.ListenerStatus) {
+		if status.Done || status.Key != key {
+			t.Errorf("got status %+v for key %s", status, key)
+		}
+		drained = append(drained, key)
+	})
+	// DrainListeners runs on the run goroutine, so once a ping gets through it has finished
+	l.Ping(patience)
+
+	if want := []string{"a", "b", "b", "s", "p/"}; !reflect.DeepEqual(drained, want) {
+		t.Fatalf("drained %v, want %v", drained, want)
+	}
+	if n := l.ListenerCount(); n != 0 {
+		t.Fatalf("%d listeners left after draining", n)
+	}
+	for _, ch := range append(chans, sub) {
+		if e := recv(t, ch); e.Error != waitloop.ErrCanceled {
+			t.Fatalf("got %+v, want ErrCanceled", e)
+		}
+		closed(t, ch)
+	}
+	if n := send(t, l, waitloop.Event{Key: "a"}); n != 0 {
+		t.Fatalf("event reached %d listeners after draining", n)
+	}
+}
+
+func TestRemainingTTL(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	fired, firedID := l.WaitWithID("fired")
+	_, expiringID := l.WaitWithID("expiring")
+	waitListeners(t, l, 2)
+
+	for _, step := range []struct{ advance, want time.Duration }{
+		{0, time.Minute},
+		{15 * time.Second, 45 * time.Second},
+		{30 * time.Second, 15 * time.Second},
+	} {
+		clock.Advance(step.advance)
+		if remaining, ok := l.RemainingTTL(expiringID); !ok || remaining != step.want {
+			t.Fatalf("got %v, %v; want %v remaining", remaining, ok, step.want)
+		}
+	}
+
+	send(t, l, waitloop.Event{Key: "fired"})
+	recv(t, fired)
+	if _, ok := l.RemainingTTL(firedID); ok {
+		t.Fatal("RemainingTTL reported a listener that fired")
+	}
+	advance(t, l, clock, time.Minute)
+	if _, ok := l.RemainingTTL(expiringID); ok {
+		t.Fatal("RemainingTTL reported a listener that expired")
+	}
+	if _, ok := l.RemainingTTL(12345); ok {
+		t.Fatal("RemainingTTL reported a listener that never existed")
+	}
+}
+
+func TestBroadcastReachesEveryKey(t *testing.T) {
+	l := newLoop(t, nil)
+	chans := map[string]<-chan waitloop.Event{
+		"a":      l.Wait("a"),
+		"b":      l.Wait("b"),
+		"c":      l.Wait("c"),
+		"prefix": l.WaitPrefix("prefix"),
+	}
+	waitListeners(t, l, len(chans))
+
+	if err := l.Broadcast("all"); err != nil {
+		t.Fatal(err)
+	}
+	for key, ch := range chans {
+		if e := recv(t, ch); e.Data != "all" || e.Error != nil {
+			t.Fatalf("%s got %+v, want the broadcast", key, e)
+		}
+	}
+	waitListeners(t, l, 0)
+
+	// The loop keeps running
+	ch := l.Wait("a")
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "a", Data: "after"})
+	if e := recv(t, ch); e.Data != "after" {
+		t.Fatalf("got %v, want the event sent after the broadcast", e.Data)
+	}
+}
+
+func TestBroadcastAfterTerminate(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Terminate()
+	stopped(t, l)
+	if err := l.Broadcast("all"); err != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", err)
+	}
+}
+
+func TestBroadcastSkipsExpiredListeners(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{CleanupInterval: time.Hour})
+	expired := l.WaitTTL("a", time.Minute)
+	live := l.WaitTTL("b", 2*time.Hour)
+	waitListeners(t, l, 2)
+
+	// Past the first TTL, but before any cleanup pass has timed it out
+	clock.Advance(2 * time.Minute)
+	if err := l.Broadcast("all"); err != nil {
+		t.Fatal(err)
+	}
+	if e := recv(t, live); e.Data != "all" {
+		t.Fatalf("got %v, want the broadcast", e.Data)
+	}
+	noRecv(t, expired)
+
+	advance(t, l, clock, time.Hour)
+	if e := recv(t, expired); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %+v, want ErrTimedOut", e)
+	}
+}
+
+func TestSubscriptionsReportsEachKind(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	start := clock.Now()
+	_, id := l.WaitWithID("a")
+	l.WaitWork("b", 0)
+	_, cancel := l.SubscribeSet([]string{"c"})
+	defer cancel()
+	l.WaitAny("d", "e")
+	l.WaitPrefix("p/")
+	waitListeners(t, l, 6)
+
+	want := []struct {
+		key  string
+		kind waitloop.SubscriptionKind
+	}{
+		{"a", waitloop.SubscriptionWait},
+		{"b", waitloop.SubscriptionWorker},
+		{"c", waitloop.SubscriptionPersistent},
+		{"d", waitloop.SubscriptionGroup},
+		{"e", waitloop.SubscriptionGroup},
+		{"p/", waitloop.SubscriptionPrefix},
+	}
+	subs := l.Subscriptions()
+	if len(subs) != len(want) {
+		t.Fatalf("got %+v, want %d subscriptions", subs, len(want))
+	}
+	for i, w := range want {
+		if subs[i].Key != w.key || subs[i].Kind != w.kind {
+			t.Fatalf("subscription %d is %s on %q, want %s on %q", i, subs[i].Kind, subs[i].Key, w.kind, w.key)
+		}
+		if expiration := subs[i].Expiration; w.kind == waitloop.SubscriptionPersistent {
+			if !expiration.IsZero() {
+				t.Fatalf("persistent subscription expires at %v", expiration)
+			}
+		} else if !expiration.Equal(start.Add(time.Minute)) {
+			t.Fatalf("%q expires at %v, want a minute from the start", w.key, expiration)
+		}
+	}
+	if subs[0].ID != id {
+		t.Fatalf("got ID %v, want %v", subs[0].ID, id)
+	}
+	if s := waitloop.SubscriptionGroup.String(); s != "group" {
+		t.Fatalf("got %q, want group", s)
+	}
+
+	l.Terminate()
+	stopped(t, l)
+	if subs := l.Subscriptions(); subs != nil {
+		t.Fatalf("got %+v from a stopped loop, want nil", subs)
+	}
+}
@@ -0,0 +1,32 @@
+package waitloop
+
+import (
+	"fmt"
+	"strings"
+)
+
+var keyEscaper = strings.NewReplacer(`\`, `\\`, ".", `\.`)
+
+// CompositeKey is a key made of several components, e.g. CompositeKey{"user", 42, "login"}
+// Components are formatted with fmt and joined with ".", so they should have a stable string form
+type CompositeKey []interface{}
+
+// String returns the string key that the composite key maps to; "." and "\" inside components are
+// escaped, so CompositeKey{"a.b"} and CompositeKey{"a", "b"} stay distinct
+func (k CompositeKey) String() string {
+	parts := make([]string, len(k))
+	for i, c := range k {
+		parts[i] = keyEscaper.Replace(fmt.Sprint(c))
+	}
+	return strings.Join(parts, ".")
+}
+
+// WaitKey is Wait for a composite key
+func (l *Loop) WaitKey(key CompositeKey) <-chan Event {
+	return l.Wait(key.String())
+}
+
+// SendKey sends data to the listeners of a composite key
+func (l *Loop) SendKey(key CompositeKey, data interface{}) error {
+	return l.Send(Event{Key: key.String(), Data: data})
+}
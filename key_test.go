@@ -0,0 +1,45 @@
+package waitloop_test
+
+import (
+	"testing"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestCompositeKeyString(t *testing.T) {
+	for _, c := range []struct {
+		key  waitloop.CompositeKey
+		want string
+	}{
+		{waitloop.CompositeKey{"user", 42, "login"}, "user.42.login"},
+		{waitloop.CompositeKey{"a.b"}, `a\.b`},
+		{waitloop.CompositeKey{`a\`, "b"}, `a\\.b`},
+		{waitloop.CompositeKey{}, ""},
+	} {
+		if got := c.key.String(); got != c.want {
+			t.Errorf("%#v: got %q, want %q", c.key, got, c.want)
+		}
+	}
+	if (waitloop.CompositeKey{"a.b"}).String() == (waitloop.CompositeKey{"a", "b"}).String() {
+		t.Error("components containing dots collide with separate components")
+	}
+}
+
+func TestCompositeKeysMatchBetweenWaitAndSend(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitKey(waitloop.CompositeKey{"user", 42, "login"})
+	other := l.WaitKey(waitloop.CompositeKey{"user", 43, "login"})
+	waitListeners(t, l, 2)
+
+	if err := l.SendKey(waitloop.CompositeKey{"user", 42, "login"}, "ok"); err != nil {
+		t.Fatal(err)
+	}
+	if e := recv(t, ch); e.Data != "ok" || e.Key != "user.42.login" {
+		t.Fatalf("got %+v, want the event on user.42.login", e)
+	}
+	noRecv(t, other)
+
+	// A composite key is the same as its string form
+	send(t, l, waitloop.Event{Key: "user.43.login"})
+	recv(t, other)
+}
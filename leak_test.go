@@ -0,0 +1,65 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// settled waits for the goroutine count to fall back to at most base
+func settled(t *testing.T, base int) {
+	t.Helper()
+	deadline := time.Now().Add(patience)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still running, want at most %d", runtime.NumGoroutine(), base)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAbandonedListenersDoNotLeakGoroutines(t *testing.T) {
+	const n = 3000
+	base := runtime.NumGoroutine()
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	for i := 0; i < n; i++ {
+		key := fmt.Sprint(i)
+		if i >= n/3 && i < 2*n/3 {
+			l.SetKeyTTL(key, time.Second)
+		}
+		// Every channel is dropped unread
+		switch i % 3 {
+		case 0:
+			l.Wait(key)
+		case 1:
+			l.WaitSubscription(key)
+		case 2:
+			l.WaitN(key, 1)
+		}
+	}
+	waitListeners(t, l, n)
+
+	// A third of them fire, a third time out, and the rest are terminated
+	for i := 0; i < n/3; i++ {
+		l.Send(waitloop.Event{Key: fmt.Sprint(i)})
+	}
+	l.Ping(patience)
+	advance(t, l, clock, 2*time.Second)
+	l.Terminate()
+	stopped(t, l)
+	settled(t, base)
+}
+
+func TestAbandonedSubscriptionDoesNotWedgeOrderedDelivery(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{OrderedDelivery: true})
+	l.WaitSubscription("abandoned")
+	ch := l.Wait("key")
+	waitListeners(t, l, 2)
+
+	send(t, l, waitloop.Event{Key: "abandoned"})
+	send(t, l, waitloop.Event{Key: "key"})
+	recv(t, ch)
+}
@@ -0,0 +1,89 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestMaxLifetimeTerminatesTheLoop(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: 10 * time.Hour, MaxLifetime: time.Hour})
+	chans := []<-chan waitloop.Event{l.Wait("a"), l.Wait("b"), l.Wait("b")}
+	waitListeners(t, l, 3)
+
+	advance(t, l, clock, 59*time.Minute)
+	select {
+	case <-l.Done():
+		t.Fatal("loop stopped before its max lifetime")
+	default:
+	}
+	for _, ch := range chans {
+		noRecv(t, ch)
+	}
+
+	clock.Advance(time.Minute)
+	stopped(t, l)
+	for _, ch := range chans {
+		if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+			t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+		}
+		closed(t, ch)
+	}
+	if err := l.Send(waitloop.Event{Key: "a"}); err != waitloop.ErrLoopTerminated {
+		t.Fatalf("Send after the lifetime got %v, want ErrLoopTerminated", err)
+	}
+}
+
+func TestMaxLifetimeTerminateFirst(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{MaxLifetime: time.Hour})
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+
+	l.Terminate()
+	stopped(t, l)
+	if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+	// The lifetime timer is stopped with the loop
+	waitUntil(t, "the loop's timers to stop", func() bool { return clock.Pending() == 0 })
+	clock.Advance(time.Hour)
+}
+
+// alive fails the test if l has stopped
+func alive(t *testing.T, l *waitloop.Loop) {
+	t.Helper()
+	select {
+	case <-l.Done():
+		t.Fatal("loop stopped while it was in use")
+	default:
+	}
+}
+
+func TestIdleTimeoutIsResetByActivity(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{IdleTimeout: 10 * time.Second, CleanupInterval: time.Hour})
+	advance(t, l, clock, 6*time.Second)
+	send(t, l, waitloop.Event{Key: "nobody"})
+	advance(t, l, clock, 6*time.Second)
+	alive(t, l)
+	advance(t, l, clock, 3*time.Second)
+	alive(t, l)
+
+	clock.Advance(time.Second)
+	stopped(t, l)
+}
+
+func TestIdleTimeoutWaitsForListeners(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{IdleTimeout: 10 * time.Second, TTL: time.Hour, CleanupInterval: time.Hour})
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+	advance(t, l, clock, 30*time.Second)
+	alive(t, l)
+
+	send(t, l, waitloop.Event{Key: "key"})
+	recv(t, ch)
+	advance(t, l, clock, 9*time.Second)
+	alive(t, l)
+	clock.Advance(time.Second)
+	stopped(t, l)
+}
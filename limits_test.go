@@ -0,0 +1,66 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestMaxListenersPerKey(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{MaxListenersPerKey: 2})
+	a1, a2 := l.Wait("hot"), l.Wait("hot")
+	waitListeners(t, l, 2)
+
+	if e := recv(t, l.Wait("hot")); e.Error != waitloop.ErrTooManyListeners {
+		t.Fatalf("got %v, want ErrTooManyListeners", e.Error)
+	}
+	// Other keys are unaffected
+	other := l.Wait("cold")
+	waitListeners(t, l, 3)
+
+	// Once the hot key fires it has room again
+	send(t, l, waitloop.Event{Key: "hot"})
+	recv(t, a1)
+	recv(t, a2)
+	again := l.Wait("hot")
+	waitListeners(t, l, 2)
+	noRecv(t, again)
+	noRecv(t, other)
+}
+
+func TestMaxListenerBytes(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, MaxListenerBytes: 100})
+	fired := l.WaitSized("fired", 60)
+	waitListeners(t, l, 1)
+	expiring := l.WaitSized("expiring", 40)
+	waitListeners(t, l, 2)
+
+	// The budget is full: a sized wait is rejected, but one with no size still fits
+	if e := recv(t, l.WaitSized("over", 1)); e.Error != waitloop.ErrMemoryLimit {
+		t.Fatalf("got %v, want ErrMemoryLimit", e.Error)
+	}
+	l.Wait("unsized")
+	waitListeners(t, l, 3)
+
+	// Firing frees its bytes
+	send(t, l, waitloop.Event{Key: "fired"})
+	recv(t, fired)
+	l.WaitSized("readmitted", 60)
+	waitListeners(t, l, 3)
+	if e := recv(t, l.WaitSized("over", 1)); e.Error != waitloop.ErrMemoryLimit {
+		t.Fatalf("got %v, want ErrMemoryLimit", e.Error)
+	}
+
+	// So do expiry and cancellation
+	advance(t, l, clock, 2*time.Minute)
+	recv(t, expiring)
+	waitListeners(t, l, 0)
+	ch := l.WaitSized("cancelled", 100)
+	waitListeners(t, l, 1)
+	l.Cancel("cancelled")
+	cancelled(t, ch, waitloop.ErrCanceled)
+	last := l.WaitSized("last", 100)
+	waitListeners(t, l, 1)
+	noRecv(t, last)
+}
@@ -0,0 +1,83 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// logged captures a loop's log lines as "level msg key", plus the listener count for matches
+type logged struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (c *logged) log(level, msg string, keyvals ...interface{}) {
+	fields := map[interface{}]interface{}{}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fields[keyvals[i]] = keyvals[i+1]
+	}
+	line := fmt.Sprintf("%s %s %v", level, msg, fields["key"])
+	if n, ok := fields["listeners"]; ok {
+		line += fmt.Sprintf(" %v", n)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines = append(c.lines, line)
+}
+
+func (c *logged) get() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.lines...)
+}
+
+func TestLoggerLifecycle(t *testing.T) {
+	var c logged
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, Logger: c.log})
+	a1, a2 := l.Wait("a"), l.Wait("a")
+	waitListeners(t, l, 2)
+	send(t, l, waitloop.Event{Key: "a"})
+	recv(t, a1)
+	recv(t, a2)
+	send(t, l, waitloop.Event{Key: "nobody"})
+
+	l.Wait("b")
+	waitListeners(t, l, 1)
+	advance(t, l, clock, 2*time.Minute)
+	l.WaitTTL("c", time.Hour)
+	waitListeners(t, l, 1)
+	l.Terminate()
+	stopped(t, l)
+
+	want := []string{
+		"debug listener registered a",
+		"debug listener registered a",
+		"debug event matched a 2",
+		"debug listener registered b",
+		"info listener timed out b",
+		"debug listener registered c",
+		"debug listener terminated c",
+	}
+	if got := c.get(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoggerBufferFullDrop(t *testing.T) {
+	var c logged
+	l := newLoop(t, &waitloop.LoopOptions{ManualRun: true, IncomingChannelSize: 1, Logger: c.log})
+	if !l.TrySend(waitloop.Event{Key: "kept"}) {
+		t.Fatal("TrySend failed with room in the buffer")
+	}
+	if l.TrySend(waitloop.Event{Key: "dropped"}) {
+		t.Fatal("TrySend succeeded on a full buffer")
+	}
+	if got, want := c.get(), []string{"warn event dropped, buffer full dropped"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
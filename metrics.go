@@ -0,0 +1,160 @@
+package waitloop
+
+import "sync/atomic"
+
+// counters are updated atomically where things happen, so reading them never goes through run
+// The uint64 fields come first to keep them aligned for atomic access on 32-bit platforms
+type counters struct {
+	sent       uint64
+	processed  uint64
+	matched    uint64
+	registered uint64
+	delivered  uint64
+	dropped    uint64
+	timedOut   uint64
+	terminated uint64
+	listeners  int64
+}
+
+// SentEvents reports how many events have been accepted by Send
+func (l *Loop) SentEvents() uint64 {
+	return atomic.LoadUint64(&l.counters.sent)
+}
+
+// DeliveredEvents reports how many times an event has been handed to a listener
+func (l *Loop) DeliveredEvents() uint64 {
+	return atomic.LoadUint64(&l.counters.delivered)
+}
+
+// DroppedEvents reports how many events reached no listener, including those sent after termination
+func (l *Loop) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&l.counters.dropped)
+}
+
+// TimedOutListeners reports how many listeners have timed out
+func (l *Loop) TimedOutListeners() uint64 {
+	return atomic.LoadUint64(&l.counters.timedOut)
+}
+
+// ResetStats zeroes the cumulative counters (sent, processed, matched, registered, delivered,
+// dropped, timed out and terminated), so that later readings count from now; ListenerCount is a
+// live gauge, and is left alone
+func (l *Loop) ResetStats() {
+	atomic.StoreUint64(&l.counters.sent, 0)
+	atomic.StoreUint64(&l.counters.processed, 0)
+	atomic.StoreUint64(&l.counters.matched, 0)
+	atomic.StoreUint64(&l.counters.registered, 0)
+	atomic.StoreUint64(&l.counters.delivered, 0)
+	atomic.StoreUint64(&l.counters.dropped, 0)
+	atomic.StoreUint64(&l.counters.timedOut, 0)
+	atomic.StoreUint64(&l.counters.terminated, 0)
+}
+
+// ListenerCount reports how many listeners are currently registered
+func (l *Loop) ListenerCount() int {
+	return int(atomic.LoadInt64(&l.counters.listeners))
+}
+
+// ChannelStats is how full the loop's incoming buffers are. Events waiting to be processed sit
+// either in the incoming channel or in the priority queue behind it, which share the
+// LoopOptions.IncomingChannelSize reported as EventsCap
+type ChannelStats struct {
+	EventsLen, EventsCap       int
+	ListenersLen, ListenersCap int
+}
+
+// ChannelStats reports the current fill and capacity of the incoming event and listener buffers;
+// buffers that stay near capacity mean producers are outpacing the loop. Once the loop has
+// stopped only the capacities are reported
+func (l *Loop) ChannelStats() ChannelStats {
+	empty := ChannelStats{EventsCap: cap(l.incomingEvents), ListenersCap: cap(l.incomingListeners)}
+	stats := make(chan ChannelStats, 1)
+	if !l.exec(func() {
+		full := empty
+		full.EventsLen = len(l.incomingEvents) + l.queue.Len()
+		full.ListenersLen = len(l.incomingListeners)
+		stats <- full
+	}) {
+		return empty
+	}
+	return <-stats
+}
+
+// LoopStats is a snapshot of the loop's listeners and of what it has done since it started (or
+// since ResetStats)
+type LoopStats struct {
+	// Listeners is how many listeners are registered, and Keys how many distinct keys (or
+	// prefixes) they wait on
+	Listeners int
+	Keys      int
+
+	// Processed is how many events the loop has matched against its listeners
+	Processed uint64
+
+	// TimedOut is how many listeners have expired, and Terminated how many were ended by Terminate
+	TimedOut   uint64
+	Terminated uint64
+}
+
+// Stats reports a LoopStats snapshot taken on the run goroutine, so the listener figures agree
+// with each other; once the loop has stopped they are zero and only the counters remain
+func (l *Loop) Stats() LoopStats {
+	found := make(chan LoopStats, 1)
+	ok := l.exec(func() {
+		stats := LoopStats{Keys: len(l.listenerMap) + len(l.prefixMap)}
+		for _, listeners := range []map[string][]listener{l.listenerMap, l.prefixMap} {
+			for _, waiters := range listeners {
+				stats.Listeners += len(waiters)
+			}
+		}
+		l.readCounters(&stats)
+		found <- stats
+	})
+	if !ok {
+		var stats LoopStats
+		l.readCounters(&stats)
+		return stats
+	}
+	return <-found
+}
+
+func (l *Loop) readCounters(stats *LoopStats) {
+	stats.Processed = atomic.LoadUint64(&l.counters.processed)
+	stats.TimedOut = atomic.LoadUint64(&l.counters.timedOut)
+	stats.Terminated = atomic.LoadUint64(&l.counters.terminated)
+}
+
+// Metrics is a snapshot of the loop's counters for monitoring; apart from ActiveListeners, a
+// gauge, each only counts up, until ResetStats
+type Metrics struct {
+	// EventsSent is how many events Send and the like accepted
+	EventsSent uint64
+
+	// EventsMatched is how many processed events notified at least one listener
+	EventsMatched uint64
+
+	// ListenersRegistered is how many listeners were added to the loop; waits that failed before
+	// registering, or were satisfied at once by a sticky event, are not counted
+	ListenersRegistered uint64
+
+	// ListenersTimedOut is how many listeners expired, and ListenersTerminated how many were ended
+	// by Terminate
+	ListenersTimedOut   uint64
+	ListenersTerminated uint64
+
+	// ActiveListeners is how many listeners are registered right now
+	ActiveListeners int64
+}
+
+// Metrics reads the loop's counters without going through the run goroutine, so it is cheap to
+// call often; the fields are read one by one, and may be a few events apart from each other
+func (l *Loop) Metrics() Metrics {
+	return Metrics{
+		EventsSent:          atomic.LoadUint64(&l.counters.sent),
+		EventsMatched:       atomic.LoadUint64(&l.counters.matched),
+		ListenersRegistered: atomic.LoadUint64(&l.counters.registered),
+		ListenersTimedOut:   atomic.LoadUint64(&l.counters.timedOut),
+		ListenersTerminated: atomic.LoadUint64(&l.counters.terminated),
+		ActiveListeners:     atomic.LoadInt64(&l.counters.listeners),
+	}
+}
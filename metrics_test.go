@@ -0,0 +1,230 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestChannelStatsCapacities(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{IncomingChannelSize: 8, ListenerChannelSize: 16})
+	want := waitloop.ChannelStats{EventsCap: 8, ListenersCap: 16}
+	if got := l.ChannelStats(); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	l.Terminate()
+	stopped(t, l)
+	if got := l.ChannelStats(); got != want {
+		t.Fatalf("got %+v once stopped, want %+v", got, want)
+	}
+}
+
+func TestChannelStatsCountsQueuedEvents(t *testing.T) {
+	const n = 5
+	l := newLoop(t, &waitloop.LoopOptions{IncomingChannelSize: n})
+	// Each listener's hook holds up the run goroutine until it gets a token from gate
+	var entered, completed int32
+	gate := make(chan struct{})
+	defer close(gate)
+	for i := 0; i < n; i++ {
+		l.WaitWithRemoveHook(fmt.Sprint(i), func(error) {
+			atomic.AddInt32(&entered, 1)
+			<-gate
+			atomic.AddInt32(&completed, 1)
+		})
+	}
+	waitListeners(t, l, n)
+	for i := 0; i < n; i++ {
+		if err := l.Send(waitloop.Event{Key: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result := make(chan waitloop.ChannelStats, 1)
+	go func() { result <- l.ChannelStats() }()
+	var (
+		stats waitloop.ChannelStats
+		given int32
+	)
+	deadline := time.After(patience)
+	for done := false; !done; {
+		select {
+		case stats = <-result:
+			done = true
+		case <-deadline:
+			t.Fatal("timed out waiting for ChannelStats")
+		case <-time.After(time.Millisecond):
+			// Let a blocked hook finish, so the loop can get round to the stats
+			if atomic.LoadInt32(&entered) > given {
+				gate <- struct{}{}
+				given++
+			}
+		}
+	}
+
+	// Every event is in the channel, in the queue behind it, or done with; the stats ran between
+	// hooks, and no hook after them has had a token
+	if want := n - int(atomic.LoadInt32(&completed)); stats.EventsLen != want {
+		t.Fatalf("got EventsLen %d, want %d", stats.EventsLen, want)
+	}
+}
+
+func TestCountersUnderConcurrentLoad(t *testing.T) {
+	const workers, rounds = 8, 200
+	l := newLoop(t, nil)
+
+	// Read the counters the whole time, for the race detector
+	stop := make(chan struct{})
+	reading := make(chan struct{})
+	go func() {
+		defer close(reading)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if n := l.ListenerCount(); n < 0 || n > workers {
+				t.Errorf("ListenerCount %d out of range", n)
+			}
+			if l.DeliveredEvents() > l.SentEvents() {
+				t.Errorf("more events delivered than sent")
+			}
+			l.DroppedEvents()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				key := fmt.Sprint(w, "/", i)
+				ch := l.Wait(key)
+				// A miss, then a hit once the listener is registered
+				<-l.SendAck(waitloop.Event{Key: "nobody"})
+				for {
+					if n := <-l.SendAck(waitloop.Event{Key: key}); n == 1 {
+						break
+					}
+				}
+				<-ch
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-reading
+
+	const events = workers * rounds
+	if n := l.DeliveredEvents(); n != events {
+		t.Fatalf("got %d delivered, want %d", n, events)
+	}
+	if sent, dropped := l.SentEvents(), l.DroppedEvents(); sent-dropped != events || dropped < events {
+		t.Fatalf("got %d sent and %d dropped, want %d more sent than dropped", sent, dropped, events)
+	}
+	if n := l.ListenerCount(); n != 0 {
+		t.Fatalf("got %d listeners, want 0", n)
+	}
+}
+
+func TestResetStats(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	fired := l.Wait("fired")
+	l.Wait("expiring")
+	waiting := l.WaitTTL("waiting", time.Hour)
+	waitListeners(t, l, 3)
+	send(t, l, waitloop.Event{Key: "fired"})
+	recv(t, fired)
+	send(t, l, waitloop.Event{Key: "nobody"})
+	advance(t, l, clock, 2*time.Minute)
+	if l.SentEvents() == 0 || l.DeliveredEvents() == 0 || l.DroppedEvents() == 0 || l.TimedOutListeners() == 0 {
+		t.Fatalf("counters not all raised: sent %d, delivered %d, dropped %d, timed out %d",
+			l.SentEvents(), l.DeliveredEvents(), l.DroppedEvents(), l.TimedOutListeners())
+	}
+
+	l.ResetStats()
+	if l.SentEvents() != 0 || l.DeliveredEvents() != 0 || l.DroppedEvents() != 0 || l.TimedOutListeners() != 0 {
+		t.Fatalf("counters not zeroed: sent %d, delivered %d, dropped %d, timed out %d",
+			l.SentEvents(), l.DeliveredEvents(), l.DroppedEvents(), l.TimedOutListeners())
+	}
+	if stats := l.Stats(); stats.Processed != 0 || stats.TimedOut != 0 || stats.Listeners != 1 {
+		t.Fatalf("got %+v, want zeroed counters and the live listener still counted", stats)
+	}
+	if n := l.ListenerCount(); n != 1 {
+		t.Fatalf("got %d listeners, want the gauge left alone", n)
+	}
+
+	// The loop carries on, counting from zero
+	send(t, l, waitloop.Event{Key: "waiting"})
+	recv(t, waiting)
+	if l.SentEvents() != 1 || l.DeliveredEvents() != 1 {
+		t.Fatalf("got sent %d, delivered %d after the reset, want 1 each", l.SentEvents(), l.DeliveredEvents())
+	}
+}
+
+func TestStatsReflectsActivity(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	fired := l.Wait("a")
+	l.Wait("a")
+	l.Wait("b")
+	l.WaitTTL("c", time.Hour)
+	l.WaitPrefix("p/")
+	waitListeners(t, l, 5)
+	if stats := l.Stats(); stats.Listeners != 5 || stats.Keys != 4 {
+		t.Fatalf("got %+v, want 5 listeners on 4 keys", stats)
+	}
+
+	send(t, l, waitloop.Event{Key: "a"})
+	send(t, l, waitloop.Event{Key: "nobody"})
+	recv(t, fired)
+	advance(t, l, clock, 2*time.Minute)
+	stats := l.Stats()
+	want := waitloop.LoopStats{Listeners: 1, Keys: 1, Processed: 2, TimedOut: 2}
+	if stats != want {
+		t.Fatalf("got %+v, want %+v", stats, want)
+	}
+
+	l.Terminate()
+	stopped(t, l)
+	want = waitloop.LoopStats{Processed: 2, TimedOut: 2, Terminated: 1}
+	if stats := l.Stats(); stats != want {
+		t.Fatalf("got %+v after Terminate, want %+v", stats, want)
+	}
+}
+
+func TestMetricsAcrossALifecycle(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	if m := l.Metrics(); m != (waitloop.Metrics{}) {
+		t.Fatalf("got %+v on a new loop, want zeros", m)
+	}
+	fired := l.Wait("fired")
+	l.Wait("expiring")
+	l.WaitTTL("terminated", time.Hour)
+	waitListeners(t, l, 3)
+	if m := l.Metrics(); m.ListenersRegistered != 3 || m.ActiveListeners != 3 {
+		t.Fatalf("got %+v, want 3 registered and active", m)
+	}
+
+	send(t, l, waitloop.Event{Key: "fired"})
+	recv(t, fired)
+	send(t, l, waitloop.Event{Key: "nobody"})
+	advance(t, l, clock, 2*time.Minute)
+	want := waitloop.Metrics{EventsSent: 2, EventsMatched: 1, ListenersRegistered: 3, ListenersTimedOut: 1, ActiveListeners: 1}
+	if m := l.Metrics(); m != want {
+		t.Fatalf("got %+v, want %+v", m, want)
+	}
+
+	l.Terminate()
+	stopped(t, l)
+	want.ListenersTerminated, want.ActiveListeners = 1, 0
+	if m := l.Metrics(); m != want {
+		t.Fatalf("got %+v after Terminate, want %+v", m, want)
+	}
+}
@@ -0,0 +1,85 @@
+package waitloop
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// mirrorHop is one loop in the path of a mirrored event
+type mirrorHop struct {
+	loop *Loop
+	next *mirrorHop
+}
+
+// mirror forwards a loop's events for some keys (all of them if keys is nil) to another loop
+type mirror struct {
+	dst  *Loop
+	keys map[string]bool
+	box  *mailbox
+}
+
+// Mirror re-sends every event processed on l for any of keys, or for every key if none are
+// given, to dst, until the returned stop func is called or l terminates. Events are forwarded in
+// order from their own goroutine, so a slow dst never holds up l. An event is never mirrored
+// back into a loop it has already passed through, so loops may safely mirror each other
+func (l *Loop) Mirror(dst *Loop, keys ...string) (stop func()) {
+	m := &mirror{dst: dst, box: newMailbox()}
+	if len(keys) > 0 {
+		m.keys = map[string]bool{}
+		for _, key := range keys {
+			m.keys[key] = true
+		}
+	}
+
+	id := atomic.AddUint64(&l.nextID, 1)
+	if !l.exec(func() { l.mirrors[id] = m }) {
+		m.box.close()
+	}
+	go func() {
+		for e := range m.box.out {
+			dst.Send(e)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.exec(func() { delete(l.mirrors, id) })
+			m.box.close()
+		})
+	}
+}
+
+// mirror queues e for each mirror that wants it; runs on the run goroutine
+func (l *Loop) mirror(e Event) {
+	if len(l.mirrors) == 0 {
+		return
+	}
+	fwd := e
+	fwd.Seq = 0
+	fwd.via = &mirrorHop{loop: l, next: e.via}
+	for _, m := range l.mirrors {
+		if m.keys != nil && !m.keys[e.Key] || fwd.passed(m.dst) {
+			continue
+		}
+		m.box.put(fwd)
+	}
+}
+
+// passed reports whether e has already been through dst
+func (e Event) passed(dst *Loop) bool {
+	for hop := e.via; hop != nil; hop = hop.next {
+		if hop.loop == dst {
+			return true
+		}
+	}
+	return false
+}
+
+// stopMirrors lets every mirror finish forwarding what it has, then stop
+func (l *Loop) stopMirrors() {
+	for id, m := range l.mirrors {
+		m.box.finish()
+		delete(l.mirrors, id)
+	}
+}
@@ -0,0 +1,89 @@
+package waitloop_test
+
+import (
+	"testing"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// mirror sets up src.Mirror and returns once src has it in place
+func mirror(t *testing.T, src, dst *waitloop.Loop, keys ...string) func() {
+	t.Helper()
+	stop := src.Mirror(dst, keys...)
+	t.Cleanup(stop)
+	// Mirror hands the mirror to the run goroutine, so it is in place by the time a ping is through
+	src.Ping(patience)
+	return stop
+}
+
+func TestMirrorForwardsChosenKeys(t *testing.T) {
+	src, dst := newLoop(t, nil), newLoop(t, nil)
+	mirror(t, src, dst, "a")
+	a, b := dst.Wait("a"), dst.Wait("b")
+	waitListeners(t, dst, 2)
+
+	send(t, src, waitloop.Event{Key: "b", Data: 1})
+	send(t, src, waitloop.Event{Key: "a", Data: 2})
+	if e := recv(t, a); e.Data != 2 {
+		t.Fatalf("got %v, want 2", e.Data)
+	}
+	noRecv(t, b)
+}
+
+func TestMirrorForwardsEveryKeyInOrder(t *testing.T) {
+	src, dst := newLoop(t, nil), newLoop(t, nil)
+	mirror(t, src, dst)
+	ch := dst.WaitN("key", 3)
+	other := dst.Wait("other")
+	waitListeners(t, dst, 2)
+
+	for i := 0; i < 3; i++ {
+		src.Send(waitloop.Event{Key: "key", Data: i})
+	}
+	src.Send(waitloop.Event{Key: "other"})
+	for i := 0; i < 3; i++ {
+		if e := recv(t, ch); e.Data != i {
+			t.Fatalf("got %v, want %d", e.Data, i)
+		}
+	}
+	recv(t, other)
+}
+
+func TestMirrorStop(t *testing.T) {
+	src, dst := newLoop(t, nil), newLoop(t, nil)
+	stop := mirror(t, src, dst)
+	ch := dst.Wait("key")
+	waitListeners(t, dst, 1)
+
+	stop()
+	send(t, src, waitloop.Event{Key: "key"})
+	noRecv(t, ch)
+	// Stopping twice is harmless
+	stop()
+}
+
+func TestMirrorLoopsDoNotEcho(t *testing.T) {
+	a, b, c := newLoop(t, nil), newLoop(t, nil), newLoop(t, nil)
+	// a and b mirror each other, and also form a ring through c
+	mirror(t, a, b)
+	mirror(t, b, a)
+	mirror(t, b, c)
+	mirror(t, c, a)
+	waits := map[*waitloop.Loop]<-chan waitloop.Event{a: a.WaitN("key", 5), b: b.WaitN("key", 5), c: c.WaitN("key", 5)}
+	for l := range waits {
+		waitListeners(t, l, 1)
+	}
+
+	send(t, a, waitloop.Event{Key: "key", Data: "once"})
+	for _, ch := range waits {
+		if e := recv(t, ch); e.Data != "once" {
+			t.Fatalf("got %v, want the event", e.Data)
+		}
+	}
+	for l, ch := range waits {
+		noRecv(t, ch)
+		if n := l.SentEvents(); n != 1 {
+			t.Fatalf("a loop saw the event %d times, want once", n)
+		}
+	}
+}
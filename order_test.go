@@ -0,0 +1,62 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// hookedWaits registers n waits on key, in order, that record their name in *order as they end;
+// the hooks run on the run goroutine, so *order is safe to read once the loop has moved on
+func hookedWaits(l *waitloop.Loop, key string, n int, order *[]string) {
+	for i := 0; i < n; i++ {
+		name := fmt.Sprint(key, i)
+		l.WaitWithRemoveHook(key, func(error) { *order = append(*order, name) })
+	}
+}
+
+func TestDeliveryFollowsInsertionOrder(t *testing.T) {
+	l := newLoop(t, nil)
+	var order []string
+	hookedWaits(l, "key", 5, &order)
+	waitListeners(t, l, 5)
+
+	send(t, l, waitloop.Event{Key: "key"})
+	if want := []string{"key0", "key1", "key2", "key3", "key4"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+}
+
+func TestCleanupFollowsInsertionOrder(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	var order []string
+	hookedWaits(l, "key", 5, &order)
+	waitListeners(t, l, 5)
+
+	advance(t, l, clock, 2*time.Minute)
+	if want := []string{"key0", "key1", "key2", "key3", "key4"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+}
+
+func TestCancellingAMiddleListenerKeepsTheOthersInOrder(t *testing.T) {
+	l := newLoop(t, nil)
+	var order []string
+	hookedWaits(l, "key", 2, &order)
+	middle, cancel := l.WaitCancelable("key")
+	l.WaitWithRemoveHook("key", func(error) { order = append(order, "last") })
+	waitListeners(t, l, 4)
+
+	cancel()
+	cancelled(t, middle, waitloop.ErrCanceled)
+	waitListeners(t, l, 3)
+	if n := send(t, l, waitloop.Event{Key: "key"}); n != 3 {
+		t.Fatalf("event reached %d listeners, want 3", n)
+	}
+	if want := []string{"key0", "key1", "last"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,62 @@
+package waitloop_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// arrivals watches chans until every one has an event buffered, failing the test if one fills
+// before a channel ahead of it; nothing reads them meanwhile, so a channel that has filled stays
+// full, and reading them back to front means any that was seen full had every one ahead of it full
+func arrivals(t *testing.T, chans []<-chan waitloop.Event) {
+	t.Helper()
+	deadline := time.Now().Add(patience)
+	full := make([]bool, len(chans))
+	for {
+		for i := len(chans) - 1; i >= 0; i-- {
+			full[i] = len(chans[i]) > 0
+		}
+		for i := 1; i < len(chans); i++ {
+			if full[i] && !full[i-1] {
+				t.Fatalf("listener %d has its event before listener %d", i, i-1)
+			}
+		}
+		if full[len(chans)-1] {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for every listener to be served")
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestOrderedDeliveryIsFIFO(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{OrderedDelivery: true})
+	for round := 0; round < 100; round++ {
+		chans := []<-chan waitloop.Event{l.Wait("key"), l.Wait("key"), l.Wait("key")}
+		waitListeners(t, l, len(chans))
+
+		l.Send(waitloop.Event{Key: "key", Data: round})
+		arrivals(t, chans)
+		for _, ch := range chans {
+			if e := recv(t, ch); e.Data != round {
+				t.Fatalf("got %v, want %d", e.Data, round)
+			}
+			closed(t, ch)
+		}
+	}
+}
+
+func TestOrderedDeliveryAcrossEvents(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{OrderedDelivery: true})
+	first, second := l.Wait("first"), l.Wait("second")
+	waitListeners(t, l, 2)
+
+	l.Send(waitloop.Event{Key: "first"})
+	l.Send(waitloop.Event{Key: "second"})
+	arrivals(t, []<-chan waitloop.Event{first, second})
+}
@@ -0,0 +1,59 @@
+package waitloop
+
+import "sync/atomic"
+
+// PanicPolicy is what the loop does when its goroutine panics (see LoopOptions.PanicPolicy)
+type PanicPolicy int
+
+const (
+	// PanicTerminate recovers and terminates the loop, notifying every listener
+	PanicTerminate PanicPolicy = iota
+	// PanicRestart recovers and keeps the loop running
+	PanicRestart
+	// PanicPropagate lets the panic through, which crashes the program unless the loop was started
+	// with RunLoop under a recover
+	PanicPropagate
+)
+
+// recoverPanic applies the loop's PanicPolicy; serve defers it
+func (l *Loop) recoverPanic() {
+	if l.panicPolicy == PanicPropagate {
+		return
+	}
+	if recover() == nil {
+		return
+	}
+	if l.panicPolicy != PanicRestart {
+		atomic.StoreInt32(&l.terminated, 1)
+	}
+}
+
+// caught is a panic recovered from one listener's delivery, to be raised again once the rest of
+// its batch has been delivered
+type caught struct {
+	value interface{}
+}
+
+// each calls fn for every listener in batch, carrying on past any that panic, because the batch
+// is already out of the listener maps and terminate could no longer reach the rest; it returns
+// the first panic, if there was one
+func each(batch []listener, fn func(listener)) (p *caught) {
+	for _, lis := range batch {
+		func() {
+			defer func() {
+				if r := recover(); r != nil && p == nil {
+					p = &caught{r}
+				}
+			}()
+			fn(lis)
+		}()
+	}
+	return p
+}
+
+// raise panics again with the caught value, if there is one, for the PanicPolicy to handle
+func (p *caught) raise() {
+	if p != nil {
+		panic(p.value)
+	}
+}
@@ -0,0 +1,211 @@
+package waitloop_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func panics(error) { panic("misbehaving hook") }
+
+func TestPanicTerminateNotifiesTheRestOfTheBatch(t *testing.T) {
+	l := newLoop(t, nil)
+	l.WaitWithRemoveHook("key", panics)
+	ch := l.Wait("key")
+	waitListeners(t, l, 2)
+
+	l.Send(waitloop.Event{Key: "key"})
+	stopped(t, l)
+	// Either the event or termination, but never nothing
+	e := recv(t, ch)
+	if e.Error != nil && e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want the event or ErrLoopTerminated", e.Error)
+	}
+}
+
+func TestPanicRestartDeliversTheRestOfTheBatch(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{PanicPolicy: waitloop.PanicRestart})
+	l.WaitWithRemoveHook("key", panics)
+	ch := l.Wait("key")
+	waitListeners(t, l, 2)
+
+	l.Send(waitloop.Event{Key: "key", Data: 1})
+	if e := recv(t, ch); e.Error != nil || e.Data != 1 {
+		t.Fatalf("got %+v, want the event", e)
+	}
+	if !l.Ping(patience) {
+		t.Fatal("loop stopped after a recovered panic")
+	}
+}
+
+func TestPanicDuringTerminationNotifiesEveryListener(t *testing.T) {
+	l := newLoop(t, nil)
+	l.WaitWithRemoveHook("key", panics)
+	ch := l.Wait("key")
+	waitListeners(t, l, 2)
+
+	l.Terminate()
+	stopped(t, l)
+	if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+}
+
+func TestPanicTerminateNotifiesOtherKeys(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{PanicPolicy: waitloop.PanicTerminate})
+	l.WaitWithRemoveHook("key", panics)
+	other := l.Wait("other")
+	waitListeners(t, l, 2)
+
+	l.Send(waitloop.Event{Key: "key"})
+	stopped(t, l)
+	if e := recv(t, other); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+	if err := l.Send(waitloop.Event{Key: "other"}); err != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", err)
+	}
+}
+
+func TestPanicRestartKeepsOtherKeys(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{PanicPolicy: waitloop.PanicRestart})
+	l.WaitWithRemoveHook("key", panics)
+	other := l.Wait("other")
+	waitListeners(t, l, 2)
+
+	l.Send(waitloop.Event{Key: "key"})
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "other", Data: 1})
+	if e := recv(t, other); e.Error != nil || e.Data != 1 {
+		t.Fatalf("got %+v, want the event", e)
+	}
+}
+
+// promptly calls fn, failing the test if it has not returned within patience
+func promptly(t *testing.T, what string, fn func() int) int {
+	t.Helper()
+	result := make(chan int, 1)
+	go func() { result <- fn() }()
+	select {
+	case n := <-result:
+		return n
+	case <-time.After(patience):
+		t.Fatalf("%s hung after a panic", what)
+		return 0
+	}
+}
+
+func TestPanicStillReturnsTheCount(t *testing.T) {
+	ends := []struct {
+		name string
+		end  func(l *waitloop.Loop) int
+	}{
+		{"Cancel", func(l *waitloop.Loop) int { return l.Cancel("key") }},
+		{"TimeoutKeys", func(l *waitloop.Loop) int { return l.TimeoutKeys([]string{"key"}) }},
+	}
+	policies := map[string]waitloop.PanicPolicy{"Terminate": waitloop.PanicTerminate, "Restart": waitloop.PanicRestart}
+	for name, policy := range policies {
+		for _, c := range ends {
+			t.Run(c.name+"/"+name, func(t *testing.T) {
+				l := newLoop(t, &waitloop.LoopOptions{PanicPolicy: policy})
+				l.WaitWithRemoveHook("key", panics)
+				ch := l.Wait("key")
+				waitListeners(t, l, 2)
+
+				if n := promptly(t, c.name, func() int { return c.end(l) }); n != 2 {
+					t.Fatalf("%s returned %d, want 2", c.name, n)
+				}
+				recv(t, ch)
+			})
+		}
+	}
+}
+
+func TestPanicInSendWherePredicate(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{PanicPolicy: waitloop.PanicRestart})
+	low := l.WaitPriority("key", 1)
+	high := l.WaitPriority("key", 2)
+	waitListeners(t, l, 2)
+
+	n := promptly(t, "SendWhere", func() int {
+		return l.SendWhere("key", 1, func(info waitloop.ListenerInfo) bool {
+			if info.Priority == 1 {
+				panic("misbehaving predicate")
+			}
+			return true
+		})
+	})
+	if n != 1 {
+		t.Fatalf("SendWhere notified %d listeners, want 1", n)
+	}
+	if e := recv(t, high); e.Data != 1 {
+		t.Fatalf("got %+v, want the event", e)
+	}
+	// The listener whose predicate panicked keeps waiting
+	waitListeners(t, l, 1)
+	noRecv(t, low)
+}
+
+func TestPanicInOnFireClosesTheAck(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{
+		PanicPolicy: waitloop.PanicRestart,
+		OnFire:      func(string, int) { panic("misbehaving hook") },
+	})
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+
+	if _, ok := acked(t, l.SendAck(waitloop.Event{Key: "key"})); ok {
+		t.Fatal("got a count for an event whose OnFire hook panicked")
+	}
+	recv(t, ch)
+	if !l.Ping(patience) {
+		t.Fatal("loop stopped after a recovered panic")
+	}
+}
+
+func TestPanicInOnFireReturnsFromSendWhenReady(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{
+		PanicPolicy: waitloop.PanicRestart,
+		OnFire:      func(string, int) { panic("misbehaving hook") },
+	})
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+
+	var err error
+	promptly(t, "SendWhenReady", func() int {
+		err = l.SendWhenReady(context.Background(), "key", 1)
+		return 0
+	})
+	if err != nil {
+		t.Fatalf("got %v, want the event sent", err)
+	}
+	recv(t, ch)
+}
+
+func TestPanicPropagate(t *testing.T) {
+	// The panic takes the process down, so it happens in a copy of the test binary
+	if os.Getenv("WAITLOOP_PANIC_PROPAGATE") == "1" {
+		l := waitloop.NewCustom(&waitloop.LoopOptions{PanicPolicy: waitloop.PanicPropagate})
+		l.WaitWithRemoveHook("key", panics)
+		for l.ListenerCount() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		l.Send(waitloop.Event{Key: "key"})
+		<-l.Done()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPanicPropagate$")
+	cmd.Env = append(os.Environ(), "WAITLOOP_PANIC_PROPAGATE=1")
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatal("process survived a propagated panic")
+	}
+	if !strings.Contains(string(out), "misbehaving hook") {
+		t.Fatalf("process failed without the hook's panic:\n%s", out)
+	}
+}
@@ -0,0 +1,62 @@
+package waitloop
+
+// PauseKey holds events for key instead of delivering them, until ResumeKey; other keys are
+// unaffected
+func (l *Loop) PauseKey(key string) {
+	l.exec(func() {
+		if _, ok := l.paused[key]; !ok {
+			l.paused[key] = nil
+		}
+	})
+}
+
+// ResumeKey delivers the events held for key since PauseKey, in the order they were processed,
+// and lets later ones through
+func (l *Loop) ResumeKey(key string) {
+	l.exec(func() {
+		held, ok := l.paused[key]
+		if !ok {
+			return
+		}
+		delete(l.paused, key)
+		for _, e := range held {
+			l.dispatch(e)
+		}
+	})
+}
+
+// dispatch processes e, or holds it if its key is paused or it is being coalesced, then
+// acknowledges it to SendAck; it returns how many listeners were notified
+func (l *Loop) dispatch(e sentEvent) int {
+	if held, ok := l.paused[e.event.Key]; ok {
+		l.paused[e.event.Key] = append(held, e)
+		return 0
+	}
+	if l.coalesce(e) {
+		return 0
+	}
+	return l.process(e)
+}
+
+// process processes e and acknowledges it, returning how many listeners were notified; if a hook
+// panics, the acknowledgement is still closed, without a count
+func (l *Loop) process(e sentEvent) int {
+	acked := false
+	defer func() {
+		if !acked && e.ack != nil {
+			close(e.ack)
+		}
+	}()
+	notified := l.processEvent(e.event, e.match)
+	acknowledge(e, notified)
+	acked = true
+	return notified
+}
+
+// acknowledge tells SendAck how many listeners e notified
+func acknowledge(e sentEvent, notified int) {
+	if e.ack != nil {
+		e.ack <- notified
+		close(e.ack)
+	}
+}
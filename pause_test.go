@@ -0,0 +1,128 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestPauseKeyHoldsEventsUntilResume(t *testing.T) {
+	l := newLoop(t, nil)
+	paused := l.WaitN("paused", 3)
+	other := l.Wait("other")
+	waitListeners(t, l, 2)
+
+	l.PauseKey("paused")
+	for i := 0; i < 3; i++ {
+		l.Send(waitloop.Event{Key: "paused", Data: i})
+	}
+	if n := send(t, l, waitloop.Event{Key: "other"}); n != 1 {
+		t.Fatalf("event on another key reached %d listeners, want 1", n)
+	}
+	recv(t, other)
+	noRecv(t, paused)
+
+	l.ResumeKey("paused")
+	for i := 0; i < 3; i++ {
+		if e := recv(t, paused); e.Data != i {
+			t.Fatalf("got %v, want %d", e.Data, i)
+		}
+	}
+}
+
+func TestSendWhereGoesThroughTheEventPipeline(t *testing.T) {
+	var fired []string
+	l := newLoop(t, &waitloop.LoopOptions{
+		OnFire: func(key string, notified int) { fired = append(fired, key) },
+	})
+	mirror := newLoop(t, nil)
+	defer l.Mirror(mirror, "key")()
+	mirrored := mirror.Wait("key")
+	high := l.WaitPriority("key", 1)
+	low := l.WaitPriority("key", 0)
+	waitListeners(t, l, 2)
+	waitListeners(t, mirror, 1)
+
+	l.PauseKey("key")
+	if n := l.SendWhere("key", 1, func(info waitloop.ListenerInfo) bool { return info.Priority > 0 }); n != 0 {
+		t.Fatalf("SendWhere on a paused key notified %d listeners, want 0", n)
+	}
+	noRecv(t, high)
+
+	l.ResumeKey("key")
+	e := recv(t, high)
+	if e.Data != 1 || e.ID == "" {
+		t.Fatalf("got %+v, want the event with an ID", e)
+	}
+	noRecv(t, low)
+	if e := recv(t, mirrored); e.Data != 1 {
+		t.Fatalf("mirror got %v, want 1", e.Data)
+	}
+	l.Ping(patience)
+	if len(fired) != 1 || fired[0] != "key" {
+		t.Fatalf("OnFire saw %v, want the one event", fired)
+	}
+}
+
+func TestBroadcastGoesThroughTheEventPipeline(t *testing.T) {
+	l := newLoop(t, nil)
+	a, b := l.Wait("a"), l.Wait("b")
+	prefix := l.WaitPrefix("p/")
+	waitListeners(t, l, 3)
+
+	l.PauseKey("b")
+	if err := l.Broadcast("all"); err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range []<-chan waitloop.Event{a, prefix} {
+		if e := recv(t, ch); e.Data != "all" || e.ID == "" {
+			t.Fatalf("got %+v, want the broadcast with an ID", e)
+		}
+	}
+	noRecv(t, b)
+	l.ResumeKey("b")
+	if e := recv(t, b); e.Data != "all" {
+		t.Fatalf("got %v, want the held broadcast", e.Data)
+	}
+}
+
+func TestBroadcastReachesPersistentListenersOnce(t *testing.T) {
+	l := newLoop(t, nil)
+	got := make(chan waitloop.Event, 4)
+	defer l.Subscribe("p/", func(e waitloop.Event) { got <- e })()
+	prefix := l.WaitPrefix("p/")
+	waitListeners(t, l, 2)
+
+	if err := l.Broadcast("all"); err != nil {
+		t.Fatal(err)
+	}
+	recv(t, prefix)
+	recv(t, got)
+	noRecv(t, got)
+}
+
+func TestPauseCleanupKeepsEventsFlowing(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	idle := l.Wait("idle")
+	busy := l.Wait("busy")
+	waitListeners(t, l, 2)
+
+	l.PauseCleanup()
+	advance(t, l, clock, 2*time.Minute)
+	noRecv(t, idle)
+	// Past its TTL, but not expired while cleanup is paused
+	if n := send(t, l, waitloop.Event{Key: "busy", Data: 1}); n != 1 {
+		t.Fatalf("event reached %d listeners, want 1", n)
+	}
+	if e := recv(t, busy); e.Data != 1 {
+		t.Fatalf("got %+v, want the event", e)
+	}
+
+	l.ResumeCleanup()
+	noRecv(t, idle)
+	advance(t, l, clock, time.Second)
+	if e := recv(t, idle); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+}
@@ -0,0 +1,77 @@
+package waitloop
+
+import "sync"
+
+// workerPool runs jobs on a fixed set of goroutines; the jobs must not block for long, since a
+// full queue holds up whoever submits the next one
+type workerPool struct {
+	mu      sync.Mutex
+	jobs    chan func()
+	stopped bool
+}
+
+func newWorkerPool(workers, queue int) *workerPool {
+	p := &workerPool{jobs: make(chan func(), queue)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// submit queues job, waiting for room if the queue is full, and returns false if the pool stopped
+func (p *workerPool) submit(job func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return false
+	}
+	p.jobs <- job
+	return true
+}
+
+// stop lets the workers exit once they have run every queued job
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.jobs)
+	}
+}
+
+// sequencer runs jobs one at a time, in the order they were submitted, on a goroutine that only
+// lives while there is work; submit never blocks
+type sequencer struct {
+	mu      sync.Mutex
+	jobs    []func()
+	running bool
+}
+
+func (s *sequencer) submit(job func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+	if !s.running {
+		s.running = true
+		go s.drain()
+	}
+}
+
+func (s *sequencer) drain() {
+	for {
+		s.mu.Lock()
+		if len(s.jobs) == 0 {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		job := s.jobs[0]
+		s.jobs = s.jobs[1:]
+		s.mu.Unlock()
+		job()
+	}
+}
@@ -0,0 +1,132 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestPooledDeliveryReachesEveryListener(t *testing.T) {
+	const n = 5000
+	l := newLoop(t, &waitloop.LoopOptions{DeliveryWorkers: 2, IncomingChannelSize: 16})
+	chans := make([]<-chan waitloop.Event, n)
+	for i := range chans {
+		chans[i] = l.Wait("key")
+	}
+	waitListeners(t, l, n)
+
+	if got := send(t, l, waitloop.Event{Key: "key", Data: 1}); got != n {
+		t.Fatalf("event reached %d listeners, want %d", got, n)
+	}
+	for _, ch := range chans {
+		if e := recv(t, ch); e.Data != 1 {
+			t.Fatalf("got %v, want 1", e.Data)
+		}
+		closed(t, ch)
+	}
+}
+
+func TestPooledDeliveryIsBounded(t *testing.T) {
+	const n = 5000
+	base := runtime.NumGoroutine()
+	l := newLoop(t, &waitloop.LoopOptions{DeliveryWorkers: 4, IncomingChannelSize: 16})
+	for i := 0; i < n; i++ {
+		l.Wait("key")
+	}
+	waitListeners(t, l, n)
+
+	var peak int64
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			if g := int64(runtime.NumGoroutine()); g > atomic.LoadInt64(&peak) {
+				atomic.StoreInt64(&peak, g)
+			}
+			select {
+			case <-stop:
+				return
+			default:
+				runtime.Gosched()
+			}
+		}
+	}()
+	send(t, l, waitloop.Event{Key: "key"})
+	close(stop)
+	<-sampled
+
+	// The loop, its workers, the sampler and a little slack
+	if limit := int64(base + 1 + 4 + 1 + 4); peak > limit {
+		t.Fatalf("%d goroutines at the peak, want at most %d", peak, limit)
+	}
+}
+
+func TestPooledDeliveryOfTimeouts(t *testing.T) {
+	const n = 1000
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, DeliveryWorkers: 1, IncomingChannelSize: 8})
+	chans := make([]<-chan waitloop.Event, n)
+	for i := range chans {
+		chans[i] = l.Wait(fmt.Sprint(i))
+	}
+	waitListeners(t, l, n)
+
+	advance(t, l, clock, 2*time.Minute)
+	for _, ch := range chans {
+		if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+			t.Fatalf("got %v, want ErrTimedOut", e.Error)
+		}
+	}
+}
+
+// benchmarkDelivery registers b.N listeners on one key, fires them all with one event and waits
+// for every delivery, reporting how many goroutines were running at the end of the fire
+func benchmarkDelivery(b *testing.B, options *waitloop.LoopOptions) {
+	l := waitloop.NewCustom(options)
+	defer l.Terminate()
+	chans := make([]<-chan waitloop.Event, b.N)
+	for i := range chans {
+		chans[i] = l.Wait("key")
+	}
+	for l.ListenerCount() < b.N {
+		runtime.Gosched()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	<-l.SendAck(waitloop.Event{Key: "key"})
+	b.ReportMetric(float64(runtime.NumGoroutine()), "goroutines")
+	for _, ch := range chans {
+		<-ch
+	}
+}
+
+func BenchmarkDeliveryPooled(b *testing.B) {
+	benchmarkDelivery(b, &waitloop.LoopOptions{})
+}
+
+func BenchmarkDeliveryOneWorker(b *testing.B) {
+	benchmarkDelivery(b, &waitloop.LoopOptions{DeliveryWorkers: 1})
+}
+
+func BenchmarkDeliveryOrdered(b *testing.B) {
+	benchmarkDelivery(b, &waitloop.LoopOptions{OrderedDelivery: true})
+}
+
+// BenchmarkCleanupChurn times out b.N listeners in one cleanup pass
+func BenchmarkCleanupChurn(b *testing.B) {
+	l := waitloop.NewCustom(&waitloop.LoopOptions{TTL: time.Millisecond, CleanupInterval: time.Millisecond})
+	defer l.Terminate()
+	b.ReportAllocs()
+	chans := make([]<-chan waitloop.Event, b.N)
+	for i := range chans {
+		chans[i] = l.Wait(fmt.Sprint(i))
+	}
+	for _, ch := range chans {
+		<-ch
+	}
+}
@@ -0,0 +1,44 @@
+package waitloop_test
+
+import (
+	"testing"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestWaitPrefixOverlappingPrefixesAndExactKey(t *testing.T) {
+	l := newLoop(t, nil)
+	exact := l.Wait("user.123.login")
+	user123 := l.WaitPrefix("user.123.")
+	user := l.WaitPrefix("user.")
+	other := l.WaitPrefix("user.456.")
+	waitListeners(t, l, 4)
+
+	if n := send(t, l, waitloop.Event{Key: "user.123.login", Data: 1}); n != 3 {
+		t.Fatalf("event reached %d listeners, want 3", n)
+	}
+	for name, ch := range map[string]<-chan waitloop.Event{"exact": exact, "user.123.": user123, "user.": user} {
+		if e := recv(t, ch); e.Key != "user.123.login" || e.Data != 1 {
+			t.Fatalf("%s got %+v, want the login event", name, e)
+		}
+	}
+	noRecv(t, other)
+}
+
+func TestWaitPrefixMatchesOnlyItsPrefix(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitPrefix("user.")
+	waitListeners(t, l, 1)
+
+	for _, key := range []string{"user", "users.1", "admin.user.1"} {
+		if n := send(t, l, waitloop.Event{Key: key}); n != 0 {
+			t.Fatalf("%q reached %d listeners, want none", key, n)
+		}
+	}
+	noRecv(t, ch)
+	send(t, l, waitloop.Event{Key: "user.1"})
+	if e := recv(t, ch); e.Key != "user.1" {
+		t.Fatalf("got key %q, want user.1", e.Key)
+	}
+	waitListeners(t, l, 0)
+}
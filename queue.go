@@ -0,0 +1,174 @@
+package waitloop
+
+import (
+	"container/heap"
+	"time"
+)
+
+// ready is always closed; run selects on it while queued events are waiting
+var ready = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// sentEvent is an event on its way to run, with the channel that acknowledges it, if any, and
+// the listeners it is limited to, if match is set (see SendWhere)
+type sentEvent struct {
+	event Event
+	ack   chan<- int
+	match func(listener) bool
+}
+
+type queuedEvent struct {
+	sentEvent
+	queued time.Time
+	order  uint64
+}
+
+// eventQueue orders events by priority, raised by one level per aging interval spent queued
+// Since every queued event ages at the same rate, the order between two events never changes and
+// a plain heap is enough; equal events keep their arrival order
+type eventQueue struct {
+	items []queuedEvent
+	aging time.Duration
+	next  uint64
+}
+
+func (q *eventQueue) Len() int { return len(q.items) }
+
+func (q *eventQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	lead := time.Duration(a.event.Priority-b.event.Priority) * q.aging
+	if age := a.queued.Sub(b.queued); lead != age {
+		return lead > age
+	}
+	return a.order < b.order
+}
+
+func (q *eventQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *eventQueue) Push(x interface{}) { q.items = append(q.items, x.(queuedEvent)) }
+
+func (q *eventQueue) Pop() interface{} {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
+
+func (q *eventQueue) push(e sentEvent, now time.Time) {
+	q.next++
+	heap.Push(q, queuedEvent{sentEvent: e, queued: now, order: q.next})
+}
+
+func (q *eventQueue) pop() sentEvent {
+	return heap.Pop(q).(queuedEvent).sentEvent
+}
+
+// enqueue queues e along with whatever else is already buffered, so that priorities apply across
+// the whole backlog; an event keeps its slot in eventSlots while queued, so the queue and the
+// incoming buffer together hold no more than LoopOptions.IncomingChannelSize
+func (l *Loop) enqueue(e sentEvent) {
+	l.queue.push(e, l.now())
+	for {
+		select {
+		case e := <-l.incomingEvents:
+			l.queue.push(e, l.now())
+		default:
+			return
+		}
+	}
+}
+
+// dequeue takes the next event off the queue, freeing its slot for another send
+func (l *Loop) dequeue() sentEvent {
+	<-l.eventSlots
+	return l.queue.pop()
+}
+
+// flushEvents processes every event already sent, queued or still buffered, and returns how many
+// listeners they notified
+func (l *Loop) flushEvents() int {
+	for drained := false; !drained; {
+		select {
+		case e := <-l.incomingEvents:
+			l.queue.push(e, l.now())
+		default:
+			drained = true
+		}
+	}
+	notified := 0
+	for l.queue.Len() > 0 {
+		notified += l.dispatch(l.dequeue())
+	}
+	return notified
+}
+
+// strand is called after queueing on incomingListeners or incomingEvents: if the loop terminated
+// meanwhile, terminate may already have drained those buffers, so it drains them again itself,
+// failing the listeners and dropping the events, and reports true
+func (l *Loop) strand() bool {
+	if !l.isTerminated() {
+		return false
+	}
+	for {
+		select {
+		case lis := <-l.incomingListeners:
+			l.fail(lis, ErrLoopTerminated)
+		case e := <-l.incomingEvents:
+			<-l.eventSlots
+			if e.ack != nil {
+				close(e.ack)
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// dropQueued closes the acknowledgements of events that were never processed before termination
+func (l *Loop) dropQueued() {
+	for l.queue.Len() > 0 {
+		if e := l.dequeue(); e.ack != nil {
+			close(e.ack)
+		}
+	}
+	for key, held := range l.paused {
+		for _, e := range held {
+			if e.ack != nil {
+				close(e.ack)
+			}
+		}
+		delete(l.paused, key)
+	}
+	for key, held := range l.coalescing {
+		if held.event.ack != nil {
+			close(held.event.ack)
+		}
+		delete(l.coalescing, key)
+	}
+	for {
+		select {
+		case e := <-l.incomingEvents:
+			<-l.eventSlots
+			if e.ack != nil {
+				close(e.ack)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// SendAck is Send, returning a channel that yields how many listeners the event notified once run
+// has processed it, and is then closed; it is closed without a value if the loop terminates first,
+// LoopOptions.Validate rejects the event or a hook panics while it is processed
+func (l *Loop) SendAck(e Event) <-chan int {
+	ack := make(chan int, 1)
+	if l.check(e) != nil {
+		close(ack)
+		return ack
+	}
+	l.post(sentEvent{event: e, ack: ack})
+	return ack
+}
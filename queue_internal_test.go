@@ -0,0 +1,44 @@
+package waitloop
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventQueueOrder(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name      string
+		highAfter time.Duration // how long after the low priority event the high one is queued
+		want      []int
+	}{
+		{"higher priority first", 0, []int{2, 0}},
+		{"aged less than the gap", time.Second, []int{2, 0}},
+		{"aged past the gap", 3 * time.Second, []int{0, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := eventQueue{aging: time.Second}
+			q.push(sentEvent{event: Event{Priority: 0}}, start)
+			q.push(sentEvent{event: Event{Priority: 2}}, start.Add(tt.highAfter))
+			for _, want := range tt.want {
+				if got := q.pop().event.Priority; got != want {
+					t.Fatalf("popped priority %d, want %d", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEventQueueKeepsArrivalOrderAmongEquals(t *testing.T) {
+	q := eventQueue{aging: time.Second}
+	now := time.Unix(1000, 0)
+	for i := 0; i < 10; i++ {
+		q.push(sentEvent{event: Event{Data: i, Priority: 1}}, now)
+	}
+	for i := 0; i < 10; i++ {
+		if got := q.pop().event.Data; got != i {
+			t.Fatalf("popped %v, want %d", got, i)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package waitloop_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestQueuedEventsAreProcessedByPriority(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{IncomingChannelSize: 16})
+	entered, release := make(chan struct{}), make(chan struct{})
+	l.WaitWithRemoveHook("block", func(error) {
+		close(entered)
+		<-release
+	})
+	ch := l.WaitN("work", 6)
+	waitListeners(t, l, 2)
+
+	// Everything sent while run is held up is queued together
+	l.Send(waitloop.Event{Key: "block"})
+	<-entered
+	for i, priority := range []int{0, 5, -1, 5, 2, 0} {
+		l.Send(waitloop.Event{Key: "work", Data: i, Priority: priority})
+	}
+	close(release)
+
+	for _, want := range []int{1, 3, 4, 0, 5, 2} {
+		if e := recv(t, ch); e.Data != want {
+			t.Fatalf("got event %v, want %d", e.Data, want)
+		}
+	}
+}
+
+// acked reads the count from a SendAck channel and checks that it then closes
+func acked(t *testing.T, ack <-chan int) (int, bool) {
+	t.Helper()
+	select {
+	case n, ok := <-ack:
+		if !ok {
+			return 0, false
+		}
+		if _, more := <-ack; more {
+			t.Fatal("ack channel yielded a second value")
+		}
+		return n, true
+	case <-time.After(patience):
+		t.Fatal("timed out waiting for the ack")
+	}
+	return 0, false
+}
+
+func TestSendAckCountsListeners(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Wait("key")
+	l.Wait("key")
+	l.Wait("key")
+	l.Wait("other")
+	waitListeners(t, l, 4)
+
+	if n, ok := acked(t, l.SendAck(waitloop.Event{Key: "key"})); !ok || n != 3 {
+		t.Fatalf("got %d, %v; want 3", n, ok)
+	}
+	if n, ok := acked(t, l.SendAck(waitloop.Event{Key: "key"})); !ok || n != 0 {
+		t.Fatalf("got %d, %v for a key with no listeners left, want 0", n, ok)
+	}
+}
+
+func TestSendAckClosesWithoutACount(t *testing.T) {
+	t.Run("terminated", func(t *testing.T) {
+		l := newLoop(t, nil)
+		l.Terminate()
+		stopped(t, l)
+		if n, ok := acked(t, l.SendAck(waitloop.Event{Key: "key"})); ok {
+			t.Fatalf("got %d from a terminated loop", n)
+		}
+	})
+	t.Run("rejected", func(t *testing.T) {
+		l := newLoop(t, &waitloop.LoopOptions{Validate: func(waitloop.Event) error { return errors.New("no") }})
+		if n, ok := acked(t, l.SendAck(waitloop.Event{Key: "key"})); ok {
+			t.Fatalf("got %d for a rejected event", n)
+		}
+	})
+	t.Run("queued at termination", func(t *testing.T) {
+		l := newLoop(t, &waitloop.LoopOptions{IncomingChannelSize: 16})
+		entered, release := make(chan struct{}), make(chan struct{})
+		l.WaitWithRemoveHook("block", func(error) {
+			close(entered)
+			<-release
+		})
+		waitListeners(t, l, 1)
+		l.Send(waitloop.Event{Key: "block"})
+		<-entered
+		ack := l.SendAck(waitloop.Event{Key: "key"})
+		l.Terminate()
+		close(release)
+		stopped(t, l)
+		// Terminate may or may not get in ahead of the queued event, but the ack always settles
+		acked(t, ack)
+	})
+}
+
+func TestExpiredEventBehindASlowConsumerIsDropped(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	ch := l.Wait("key")
+	entered, release := make(chan struct{}), make(chan struct{})
+	l.WaitWithRemoveHook("slow", func(error) {
+		close(entered)
+		<-release
+	})
+	waitListeners(t, l, 2)
+	l.Send(waitloop.Event{Key: "slow"})
+	<-entered
+
+	// The event goes stale while it waits in the buffer behind the slow one
+	fresh := l.SendAck(waitloop.Event{Key: "key", Data: 1, Expiration: clock.Now().Add(time.Second)})
+	clock.Advance(2 * time.Second)
+	close(release)
+	if n, _ := acked(t, fresh); n != 0 {
+		t.Fatalf("stale event reached %d listeners, want none", n)
+	}
+	noRecv(t, ch)
+	if n := l.DroppedEvents(); n != 1 {
+		t.Fatalf("got %d dropped events, want 1", n)
+	}
+
+	// The listener still ends through its own TTL
+	advance(t, l, clock, time.Minute)
+	if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %+v, want ErrTimedOut", e)
+	}
+}
+
+func TestEventWithinItsExpirationIsDelivered(t *testing.T) {
+	l, clock := newFakeLoop(t, nil)
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", Data: 1, Expiration: clock.Now().Add(time.Second)})
+	if e := recv(t, ch); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+}
+
+func TestTrySendAndSendOnAFullBuffer(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{IncomingChannelSize: 2})
+	ch := l.WaitN("key", 3)
+	entered, release := make(chan struct{}), make(chan struct{})
+	l.WaitWithRemoveHook("block", func(error) {
+		close(entered)
+		<-release
+	})
+	waitListeners(t, l, 2)
+	l.Send(waitloop.Event{Key: "block"})
+	<-entered
+
+	for i := 0; i < 2; i++ {
+		if !l.TrySend(waitloop.Event{Key: "key", Data: i}) {
+			t.Fatalf("TrySend %d failed with room in the buffer", i)
+		}
+	}
+	start := time.Now()
+	if l.TrySend(waitloop.Event{Key: "key", Data: "dropped"}) {
+		t.Fatal("TrySend succeeded on a full buffer")
+	}
+	if elapsed := time.Since(start); elapsed > patience {
+		t.Fatalf("TrySend took %v on a full buffer", elapsed)
+	}
+
+	// Send waits for room instead
+	sent := make(chan error)
+	go func() { sent <- l.Send(waitloop.Event{Key: "key", Data: 2}) }()
+	select {
+	case err := <-sent:
+		t.Fatalf("Send returned %v on a full buffer", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if e := recv(t, ch); e.Data != i {
+			t.Fatalf("got %v, want %d", e.Data, i)
+		}
+	}
+}
+
+func TestQueuedEventsCountTowardsTheBuffer(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{IncomingChannelSize: 2})
+	block := func(key string) (entered, release chan struct{}) {
+		entered, release = make(chan struct{}), make(chan struct{})
+		l.WaitWithRemoveHook(key, func(error) {
+			close(entered)
+			<-release
+		})
+		return entered, release
+	}
+	entered1, release1 := block("block1")
+	entered2, release2 := block("block2")
+	waitListeners(t, l, 2)
+	l.Send(waitloop.Event{Key: "block1"})
+	<-entered1
+
+	// Both go into the queue together once the loop is free, and the first of them blocks it again
+	for _, key := range []string{"block2", "queued"} {
+		if !l.TrySend(waitloop.Event{Key: key}) {
+			t.Fatalf("TrySend %s failed with room in the buffer", key)
+		}
+	}
+	close(release1)
+	<-entered2
+	defer close(release2)
+
+	// One event is still queued, which leaves room for just one more
+	if !l.TrySend(waitloop.Event{Key: "buffered"}) {
+		t.Fatal("TrySend failed with room in the buffer")
+	}
+	if l.TrySend(waitloop.Event{Key: "dropped"}) {
+		t.Fatal("TrySend succeeded with the queue and buffer full")
+	}
+	sent := make(chan error, 1)
+	go func() { sent <- l.Send(waitloop.Event{Key: "waiting"}) }()
+	select {
+	case err := <-sent:
+		t.Fatalf("Send returned %v with the queue and buffer full", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestTrySendTerminated(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Terminate()
+	stopped(t, l)
+	if l.TrySend(waitloop.Event{Key: "key"}) {
+		t.Fatal("TrySend succeeded on a terminated loop")
+	}
+}
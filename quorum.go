@@ -0,0 +1,174 @@
+package waitloop
+
+import "errors"
+
+// ErrInvalidQuorum is sent in the Event if a quorum asks for more keys than it waits on
+var ErrInvalidQuorum = errors.New("quorum larger than key set")
+
+// quorum tracks a group of listeners that complete together; it is only touched on the run goroutine
+type quorum struct {
+	loop    *Loop
+	need    int
+	pending map[uint64]string
+	fired   []Event
+	done    bool
+	finish  func(fired []Event, err *Event)
+}
+
+func (q *quorum) handle(id uint64, e Event) {
+	if q.done {
+		return
+	}
+	delete(q.pending, id)
+	if e.Error == nil {
+		q.fired = append(q.fired, e)
+		if len(q.fired) >= q.need {
+			q.complete(nil)
+		}
+		return
+	}
+	if len(q.fired)+len(q.pending) < q.need {
+		q.complete(&e)
+	}
+}
+
+// complete removes the listeners that have not fired and reports the result
+func (q *quorum) complete(err *Event) {
+	q.done = true
+	for id, key := range q.pending {
+		q.loop.removeListener(key, id)
+	}
+	q.finish(q.fired, err)
+}
+
+// gather registers one listener per distinct key and calls finish on the run goroutine once n of
+// them fired, or with the failing event once that is no longer possible
+// The returned cancel func ends the group early with the given error; it reports false if the
+// loop was already terminated
+func (l *Loop) gather(keys []string, n int, finish func(fired []Event, err *Event)) (cancel func(error) bool) {
+	q := &quorum{loop: l, need: n, pending: map[uint64]string{}, finish: finish}
+	var listeners []listener
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		lis := l.waitListener(key, 0)
+		id := lis.ID
+		lis.Group = true
+		lis.Handler = func(e Event) { q.handle(id, e) }
+		q.pending[id] = key
+		listeners = append(listeners, lis)
+	}
+
+	cancel = func(err error) bool {
+		return l.exec(func() {
+			if !q.done {
+				q.complete(&Event{Error: err})
+			}
+		})
+	}
+
+	if err := l.admit(listeners...); err != nil {
+		finish(nil, &Event{Error: err})
+		return cancel
+	}
+
+	// Register all listeners in one step so none can fire before its siblings exist; once a sticky
+	// event completes the group, the rest are left out rather than taking sticky events of their own
+	ok := l.exec(func() {
+		for _, lis := range listeners {
+			if q.done {
+				break
+			}
+			l.registerListener(lis)
+		}
+	})
+	if !ok {
+		finish(nil, &Event{Error: ErrLoopTerminated})
+	}
+	return cancel
+}
+
+// WaitQuorum waits until n of the given distinct keys have fired, and returns the channel on
+// which their events arrive; the remaining listeners are cancelled
+// If the quorum can no longer be reached (timeout or termination), the slice holds the events
+// that did fire followed by the failing one; n larger than the key set fails with ErrInvalidQuorum
+func (l *Loop) WaitQuorum(keys []string, n int) <-chan []Event {
+	out := make(chan []Event, 1)
+	distinct := map[string]bool{}
+	for _, key := range keys {
+		distinct[key] = true
+	}
+	if n > len(distinct) {
+		out <- []Event{{Error: ErrInvalidQuorum}}
+		close(out)
+		return out
+	}
+	if n <= 0 {
+		out <- []Event{}
+		close(out)
+		return out
+	}
+
+	l.gather(keys, n, func(fired []Event, err *Event) {
+		result := append([]Event{}, fired...)
+		if err != nil {
+			result = append(result, *err)
+		}
+		out <- result
+		close(out)
+	})
+	return out
+}
+
+// WaitAny waits for the first of keys to fire and returns the channel on which its Event arrives,
+// with Key set to whichever key it was; the other listeners are cancelled. If none of them can
+// fire any more (they all timed out, say), the last failure is sent instead
+func (l *Loop) WaitAny(keys ...string) <-chan Event {
+	out := make(chan Event, 1)
+	if len(keys) == 0 {
+		out <- Event{Error: ErrInvalidQuorum}
+		close(out)
+		return out
+	}
+
+	l.gather(keys, 1, func(fired []Event, err *Event) {
+		if err != nil {
+			l.send(out, *err)
+			return
+		}
+		l.send(out, fired[0])
+	})
+	return out
+}
+
+// WaitAll waits until every one of keys has fired, and then sends a single Event whose Data is a
+// map[string]Event of each key's event; duplicate keys count once. If that can no longer happen,
+// the Event carries the failure (ErrTimedOut, say) and its key, with Data holding those that did fire
+func (l *Loop) WaitAll(keys ...string) <-chan Event {
+	out := make(chan Event, 1)
+	distinct := map[string]bool{}
+	for _, key := range keys {
+		distinct[key] = true
+	}
+	if len(distinct) == 0 {
+		out <- Event{Data: map[string]Event{}}
+		close(out)
+		return out
+	}
+
+	l.gather(keys, len(distinct), func(fired []Event, err *Event) {
+		results := make(map[string]Event, len(fired))
+		for _, e := range fired {
+			results[e.Key] = e
+		}
+		e := Event{Data: results}
+		if err != nil {
+			e.Key, e.Error = err.Key, err.Error
+		}
+		l.send(out, e)
+	})
+	return out
+}
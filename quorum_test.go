@@ -0,0 +1,205 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// recvQuorum reads the result of a WaitQuorum
+func recvQuorum(t *testing.T, ch <-chan []waitloop.Event) []waitloop.Event {
+	t.Helper()
+	select {
+	case events := <-ch:
+		return events
+	case <-time.After(patience):
+		t.Fatal("timed out waiting for the quorum")
+	}
+	return nil
+}
+
+func TestWaitQuorumReached(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitQuorum([]string{"a", "b", "c"}, 2)
+	waitListeners(t, l, 3)
+
+	send(t, l, waitloop.Event{Key: "b", Data: 1})
+	select {
+	case events := <-ch:
+		t.Fatalf("quorum completed early with %+v", events)
+	case <-time.After(20 * time.Millisecond):
+	}
+	send(t, l, waitloop.Event{Key: "a", Data: 2})
+
+	events := recvQuorum(t, ch)
+	if len(events) != 2 || events[0].Key != "b" || events[1].Key != "a" {
+		t.Fatalf("got %+v, want the events on b and a", events)
+	}
+	// The key that did not fire is cancelled
+	waitListeners(t, l, 0)
+}
+
+func TestWaitQuorumIgnoresExtras(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitQuorum([]string{"a", "b", "c"}, 1)
+	waitListeners(t, l, 3)
+
+	send(t, l, waitloop.Event{Key: "c"})
+	if n := send(t, l, waitloop.Event{Key: "a"}); n != 0 {
+		t.Fatalf("extra event reached %d listeners, want 0", n)
+	}
+	if events := recvQuorum(t, ch); len(events) != 1 || events[0].Key != "c" {
+		t.Fatalf("got %+v, want only the event on c", events)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatal("channel not closed after the quorum")
+	}
+}
+
+func TestWaitQuorumTimesOut(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	ch := l.WaitQuorum([]string{"a", "b", "c"}, 2)
+	waitListeners(t, l, 3)
+
+	send(t, l, waitloop.Event{Key: "a"})
+	advance(t, l, clock, 2*time.Minute)
+	events := recvQuorum(t, ch)
+	if len(events) != 2 || events[0].Key != "a" || events[1].Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %+v, want the event on a then ErrTimedOut", events)
+	}
+}
+
+func TestWaitQuorumTooLarge(t *testing.T) {
+	l := newLoop(t, nil)
+	// Repeated keys count once
+	events := recvQuorum(t, l.WaitQuorum([]string{"a", "a", "b"}, 3))
+	if len(events) != 1 || events[0].Error != waitloop.ErrInvalidQuorum {
+		t.Fatalf("got %+v, want ErrInvalidQuorum", events)
+	}
+	if n := l.ListenerCount(); n != 0 {
+		t.Fatalf("%d listeners registered", n)
+	}
+}
+
+func TestWaitAnyFirstKeyWins(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitAny("a", "b", "c")
+	waitListeners(t, l, 3)
+
+	send(t, l, waitloop.Event{Key: "b", Data: 2})
+	if e := recv(t, ch); e.Key != "b" || e.Data != 2 {
+		t.Fatalf("got %+v, want b's event", e)
+	}
+	closed(t, ch)
+	// The siblings were cancelled with it
+	waitListeners(t, l, 0)
+}
+
+func TestWaitAnyDeliversOnceWhenKeysFireTogether(t *testing.T) {
+	l := newLoop(t, nil)
+	for i := 0; i < 50; i++ {
+		// Fresh keys each round, so the loser of the last round cannot reach this one
+		a, b := fmt.Sprint("a", i), fmt.Sprint("b", i)
+		ch := l.WaitAny(a, b)
+		waitListeners(t, l, 2)
+		l.Send(waitloop.Event{Key: a})
+		l.Send(waitloop.Event{Key: b})
+		if e := recv(t, ch); e.Key != a && e.Key != b {
+			t.Fatalf("got %+v, want %s's or %s's event", e, a, b)
+		}
+		closed(t, ch)
+		waitListeners(t, l, 0)
+	}
+}
+
+func TestWaitAnyTimesOutOnce(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	ch := l.WaitAny("a", "b")
+	waitListeners(t, l, 2)
+
+	advance(t, l, clock, 2*time.Minute)
+	if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %+v, want ErrTimedOut", e)
+	}
+	closed(t, ch)
+}
+
+func TestWaitAnyNoKeys(t *testing.T) {
+	l := newLoop(t, nil)
+	if e := recv(t, l.WaitAny()); e.Error != waitloop.ErrInvalidQuorum {
+		t.Fatalf("got %v, want ErrInvalidQuorum", e.Error)
+	}
+}
+
+// allResults reads the per-key results of a WaitAll
+func allResults(t *testing.T, e waitloop.Event) map[string]waitloop.Event {
+	t.Helper()
+	results, ok := e.Data.(map[string]waitloop.Event)
+	if !ok {
+		t.Fatalf("got Data %#v, want a map of results", e.Data)
+	}
+	return results
+}
+
+func TestWaitAllEveryKeyFires(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitAll("a", "b", "c")
+	waitListeners(t, l, 3)
+
+	send(t, l, waitloop.Event{Key: "c", Data: 3})
+	send(t, l, waitloop.Event{Key: "a", Data: 1})
+	noRecv(t, ch)
+	send(t, l, waitloop.Event{Key: "b", Data: 2})
+	e := recv(t, ch)
+	if e.Error != nil {
+		t.Fatal(e.Error)
+	}
+	results := allResults(t, e)
+	for key, want := range map[string]int{"a": 1, "b": 2, "c": 3} {
+		if results[key].Data != want {
+			t.Fatalf("got %+v, want %s's event", results, key)
+		}
+	}
+	closed(t, ch)
+}
+
+func TestWaitAllPartialTimeout(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	ch := l.WaitAll("a", "b")
+	waitListeners(t, l, 2)
+
+	send(t, l, waitloop.Event{Key: "a", Data: 1})
+	advance(t, l, clock, 2*time.Minute)
+	e := recv(t, ch)
+	if e.Error != waitloop.ErrTimedOut || e.Key != "b" {
+		t.Fatalf("got %+v, want b to have timed out", e)
+	}
+	results := allResults(t, e)
+	if len(results) != 1 || results["a"].Data != 1 {
+		t.Fatalf("got %+v, want only a's event", results)
+	}
+}
+
+func TestWaitAllDuplicateKeys(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitAll("a", "a", "b")
+	waitUntil(t, "listeners to register", func() bool { return l.ListenerCount() > 0 })
+	l.Ping(patience)
+
+	send(t, l, waitloop.Event{Key: "a", Data: 1})
+	noRecv(t, ch)
+	send(t, l, waitloop.Event{Key: "b", Data: 2})
+	if results := allResults(t, recv(t, ch)); len(results) != 2 {
+		t.Fatalf("got %+v, want a result for each distinct key", results)
+	}
+}
+
+func TestWaitAllNoKeys(t *testing.T) {
+	l := newLoop(t, nil)
+	e := recv(t, l.WaitAll())
+	if results := allResults(t, e); e.Error != nil || len(results) != 0 {
+		t.Fatalf("got %+v, want an empty result at once", e)
+	}
+}
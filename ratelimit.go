@@ -0,0 +1,68 @@
+package waitloop
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is sent in the Event if the listener was rejected by LoopOptions.MaxRegistrationsPerSecond
+var ErrRateLimited = errors.New("listener registration rate limited")
+
+// tokenBucket allows up to rate tokens per second, with bursts of up to one second's worth
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// take consumes n tokens if available; with reserve set it always takes them, and returns how
+// long the caller must wait before they are actually available
+func (b *tokenBucket) take(n int, reserve bool) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+
+	if b.tokens < float64(n) && !reserve {
+		return 0, false
+	}
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second)), true
+}
+
+// admit checks new listeners against LoopOptions.RequireExplicitTTL, and then applies the
+// registration rate limit to them, blocking if they are queued
+func (l *Loop) admit(listeners ...listener) error {
+	if l.requireTTL {
+		for _, lis := range listeners {
+			if lis.DefaultTTL {
+				return ErrTTLRequired
+			}
+		}
+	}
+	if l.registrations == nil {
+		return nil
+	}
+	delay, ok := l.registrations.take(len(listeners), l.queueRateLimited)
+	if !ok {
+		return ErrRateLimited
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return nil
+}
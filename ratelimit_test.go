@@ -0,0 +1,48 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestRateLimitRejectsAFlood(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{MaxRegistrationsPerSecond: 10})
+	var chans []<-chan waitloop.Event
+	for i := 0; i < 20; i++ {
+		chans = append(chans, l.Wait("key"))
+	}
+
+	rejected := 0
+	for _, ch := range chans {
+		select {
+		case e := <-ch:
+			if e.Error != waitloop.ErrRateLimited {
+				t.Fatalf("got %v, want ErrRateLimited", e.Error)
+			}
+			rejected++
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	// A burst of one second's worth is let through, and a little more may have trickled in
+	if rejected < 9 || rejected > 10 {
+		t.Fatalf("%d of 20 registrations rejected, want about 10", rejected)
+	}
+	if n := l.ListenerCount(); n != 20-rejected {
+		t.Fatalf("%d listeners registered, want %d", n, 20-rejected)
+	}
+}
+
+func TestRateLimitQueues(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{MaxRegistrationsPerSecond: 50, QueueRateLimited: true})
+	start := time.Now()
+	for i := 0; i < 60; i++ {
+		l.Wait("key")
+	}
+	// The ten over the burst wait for a fiftieth of a second each
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("60 registrations took %v, want about 200ms", elapsed)
+	}
+	waitListeners(t, l, 60)
+}
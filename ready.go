@@ -0,0 +1,86 @@
+package waitloop
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// readySend is a SendWhenReady event parked until its key has a listener
+type readySend struct {
+	event  Event
+	result chan error
+}
+
+// SendWhenReady sends data on key once at least one listener is registered there, so that the
+// event is never dropped for want of a listener; it returns ctx.Err() if ctx is done first, or
+// ErrLoopTerminated if the loop stops
+func (l *Loop) SendWhenReady(ctx context.Context, key string, data interface{}) error {
+	e := Event{Key: key, Data: data}
+	if err := l.check(e); err != nil {
+		return err
+	}
+
+	send := &readySend{event: e, result: make(chan error, 1)}
+	if !l.exec(func() {
+		if len(l.listenerMap[key]) > 0 {
+			l.sendReady(send)
+			return
+		}
+		l.readySends[key] = append(l.readySends[key], send)
+	}) {
+		return ErrLoopTerminated
+	}
+
+	select {
+	case err := <-send.result:
+		return err
+	case <-l.done:
+		return ErrLoopTerminated
+	case <-ctx.Done():
+		withdrawn := make(chan bool, 1)
+		if !l.exec(func() { withdrawn <- l.withdrawReady(send) }) {
+			return ErrLoopTerminated
+		}
+		if <-withdrawn {
+			return ctx.Err()
+		}
+		// A listener turned up just before ctx was done
+		return <-send.result
+	}
+}
+
+func (l *Loop) sendReady(send *readySend) {
+	atomic.AddUint64(&l.counters.sent, 1)
+	// The event is out even if a hook panics while it is processed
+	defer func() { send.result <- nil }()
+	l.dispatch(sentEvent{event: send.event})
+}
+
+// releaseReady sends what was waiting for key to have a listener, oldest first, for as long as
+// there still is one, so a single Wait takes a single parked send and the rest stay parked;
+// registerListener calls it
+func (l *Loop) releaseReady(key string) {
+	for len(l.readySends[key]) > 0 && len(l.listenerMap[key]) > 0 {
+		send := l.readySends[key][0]
+		l.readySends[key] = l.readySends[key][1:]
+		if len(l.readySends[key]) == 0 {
+			delete(l.readySends, key)
+		}
+		l.sendReady(send)
+	}
+}
+
+func (l *Loop) withdrawReady(send *readySend) bool {
+	key := send.event.Key
+	for i, s := range l.readySends[key] {
+		if s != send {
+			continue
+		}
+		l.readySends[key] = append(l.readySends[key][:i:i], l.readySends[key][i+1:]...)
+		if len(l.readySends[key]) == 0 {
+			delete(l.readySends, key)
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package waitloop_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// sendWhenReady calls SendWhenReady on its own goroutine, returning its result
+func sendWhenReady(l *waitloop.Loop, key string, data interface{}) <-chan error {
+	result := make(chan error, 1)
+	go func() { result <- l.SendWhenReady(context.Background(), key, data) }()
+	return result
+}
+
+func TestSendWhenReadyWaitsForAListener(t *testing.T) {
+	l := newLoop(t, nil)
+	result := sendWhenReady(l, "key", 1)
+	select {
+	case err := <-result:
+		t.Fatalf("returned %v before there was a listener", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	ch := l.Wait("key")
+	if e := recv(t, ch); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendWhenReadyReleasesOneSendPerListener(t *testing.T) {
+	l := newLoop(t, nil)
+	results := []<-chan error{sendWhenReady(l, "key", 0), sendWhenReady(l, "key", 1)}
+	// Give both sends time to park
+	time.Sleep(20 * time.Millisecond)
+
+	got := recv(t, l.Wait("key")).Data.(int)
+	if err := <-results[got]; err != nil {
+		t.Fatal(err)
+	}
+	other := 1 - got
+	select {
+	case err := <-results[other]:
+		t.Fatalf("the other send returned %v with no listener left for it", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if e := recv(t, l.Wait("key")); e.Data != other {
+		t.Fatalf("got %v, want the send still parked", e.Data)
+	}
+	if err := <-results[other]; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendWhenReadyHonoursContext(t *testing.T) {
+	l := newLoop(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.SendWhenReady(ctx, "key", nil); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	// The withdrawn send is not delivered to a later listener
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+	noRecv(t, ch)
+}
+
+func TestSendWhenReadyTerminated(t *testing.T) {
+	l := newLoop(t, nil)
+	result := sendWhenReady(l, "key", nil)
+	time.Sleep(10 * time.Millisecond)
+	l.Terminate()
+	if err := <-result; err != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", err)
+	}
+}
@@ -0,0 +1,80 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestKeyGrowsAndShrinksPastOneListener(t *testing.T) {
+	l := newLoop(t, nil)
+	first := l.Wait("key")
+	waitListeners(t, l, 1)
+	if n := send(t, l, waitloop.Event{Key: "key", Data: 1}); n != 1 {
+		t.Fatalf("event reached %d listeners, want 1", n)
+	}
+	recv(t, first)
+
+	// One listener, then a second beside it
+	a := l.Wait("key")
+	waitListeners(t, l, 1)
+	b := l.Wait("key")
+	waitListeners(t, l, 2)
+	if n := send(t, l, waitloop.Event{Key: "key", Data: 2}); n != 2 {
+		t.Fatalf("event reached %d listeners, want 2", n)
+	}
+	for _, ch := range []<-chan waitloop.Event{a, b} {
+		if e := recv(t, ch); e.Data != 2 {
+			t.Fatalf("got %v, want 2", e.Data)
+		}
+	}
+
+	// Two, with one cancelled, leaves a key with a single listener that still works
+	c, cancel := l.WaitCancelable("key")
+	d := l.Wait("key")
+	waitListeners(t, l, 2)
+	cancel()
+	cancelled(t, c, waitloop.ErrCanceled)
+	waitListeners(t, l, 1)
+	if n := send(t, l, waitloop.Event{Key: "key", Data: 3}); n != 1 {
+		t.Fatalf("event reached %d listeners, want 1", n)
+	}
+	if e := recv(t, d); e.Data != 3 {
+		t.Fatalf("got %v, want 3", e.Data)
+	}
+	if n := send(t, l, waitloop.Event{Key: "key"}); n != 0 {
+		t.Fatalf("event reached %d listeners on an emptied key", n)
+	}
+}
+
+// benchmarkRegisterFire waits on and then fires b.N keys with perKey listeners each
+func benchmarkRegisterFire(b *testing.B, perKey int) {
+	l := waitloop.NewCustom(nil)
+	defer l.Terminate()
+	keys := make([]string, b.N)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for _, key := range keys {
+		chans := make([]<-chan waitloop.Event, perKey)
+		for i := range chans {
+			chans[i] = l.Wait(key)
+		}
+		for l.ListenerCount() < perKey {
+			runtime.Gosched()
+		}
+		<-l.SendAck(waitloop.Event{Key: key})
+		for _, ch := range chans {
+			<-ch
+		}
+	}
+}
+
+func BenchmarkRegisterFireOneListener(b *testing.B) { benchmarkRegisterFire(b, 1) }
+
+func BenchmarkRegisterFireTwoListeners(b *testing.B) { benchmarkRegisterFire(b, 2) }
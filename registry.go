@@ -0,0 +1,77 @@
+package waitloop
+
+import "sync"
+
+// Registry hands out waits and subscriptions on a loop and keeps track of the ones still live, so
+// that they can all be torn down at once; the zero value is not usable, create it with NewRegistry
+type Registry struct {
+	loop    *Loop
+	mu      sync.Mutex
+	next    uint64
+	cancels map[uint64]func()
+}
+
+// NewRegistry returns an empty Registry for loop
+func NewRegistry(loop *Loop) *Registry {
+	return &Registry{loop: loop, cancels: map[uint64]func(){}}
+}
+
+// Wait is Loop.Wait, tracked by the registry until the listener gets its final event
+func (r *Registry) Wait(key string) <-chan Event {
+	out, cancel, settled := r.loop.waitCancelable(key, nil, false)
+	id := r.add(func() { cancel(ErrCanceled) })
+	go func() {
+		<-settled
+		r.remove(id)
+	}()
+	return out
+}
+
+// SubscribeSet is Loop.SubscribeSet, tracked by the registry until it is cancelled
+func (r *Registry) SubscribeSet(keys []string) (<-chan Event, func()) {
+	out, cancel := r.loop.SubscribeSet(keys)
+	id := r.add(cancel)
+	return out, func() {
+		r.remove(id)
+		cancel()
+	}
+}
+
+// Count reports how many of the registry's waits and subscriptions are still live
+func (r *Registry) Count() int {
+	select {
+	case <-r.loop.done:
+		return 0
+	default:
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.cancels)
+}
+
+// CancelAll cancels every live wait and subscription made through the registry; waits get
+// ErrCanceled, as with WaitCancelable
+func (r *Registry) CancelAll() {
+	r.mu.Lock()
+	cancels := r.cancels
+	r.cancels = map[uint64]func(){}
+	r.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+func (r *Registry) add(cancel func()) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.next++
+	r.cancels[r.next] = cancel
+	return r.next
+}
+
+func (r *Registry) remove(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cancels, id)
+}
@@ -0,0 +1,51 @@
+package waitloop_test
+
+import (
+	"testing"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestRegistryCancelAll(t *testing.T) {
+	l := newLoop(t, nil)
+	r := waitloop.NewRegistry(l)
+	waits := []<-chan waitloop.Event{r.Wait("a"), r.Wait("a"), r.Wait("b")}
+	sub, _ := r.SubscribeSet([]string{"c", "d"})
+	waitListeners(t, l, 5)
+	if n := r.Count(); n != 4 {
+		t.Fatalf("got count %d, want 4", n)
+	}
+
+	r.CancelAll()
+	for _, ch := range waits {
+		cancelled(t, ch, waitloop.ErrCanceled)
+	}
+	closed(t, sub)
+	waitListeners(t, l, 0)
+	if n := r.Count(); n != 0 {
+		t.Fatalf("got count %d after CancelAll, want 0", n)
+	}
+}
+
+func TestRegistryCountTracksEndings(t *testing.T) {
+	l := newLoop(t, nil)
+	r := waitloop.NewRegistry(l)
+	fired := r.Wait("fired")
+	r.Wait("left")
+	_, cancel := r.SubscribeSet([]string{"sub"})
+	waitListeners(t, l, 3)
+
+	send(t, l, waitloop.Event{Key: "fired"})
+	recv(t, fired)
+	waitUntil(t, "the fired wait to drop out", func() bool { return r.Count() == 2 })
+	cancel()
+	if n := r.Count(); n != 1 {
+		t.Fatalf("got count %d after cancelling the subscription, want 1", n)
+	}
+
+	l.Terminate()
+	stopped(t, l)
+	if n := r.Count(); n != 0 {
+		t.Fatalf("got count %d after Terminate, want 0", n)
+	}
+}
@@ -0,0 +1,48 @@
+package waitloop_test
+
+import (
+	"testing"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestReplyLinksARoundTrip(t *testing.T) {
+	l := newLoop(t, nil)
+	requests := l.Wait("request")
+	waitListeners(t, l, 1)
+
+	// The requester waits for the response before sending the request
+	responses := l.Wait("response")
+	waitListeners(t, l, 2)
+	send(t, l, waitloop.Event{Key: "request", Data: "ping"})
+	req := recv(t, requests)
+	if req.ID == "" {
+		t.Fatal("request was not given an ID")
+	}
+
+	// The handler replies, and the reply is answered in turn
+	if err := l.Reply(req, waitloop.Event{Key: "response", Data: "pong"}); err != nil {
+		t.Fatal(err)
+	}
+	resp := recv(t, responses)
+	if resp.CausedBy != req.ID || resp.ID == "" || resp.ID == req.ID {
+		t.Fatalf("response %+v does not link back to request %q", resp, req.ID)
+	}
+
+	acks := l.Wait("ack")
+	waitListeners(t, l, 1)
+	l.Reply(resp, waitloop.Event{Key: "ack"})
+	if ack := recv(t, acks); ack.CausedBy != resp.ID {
+		t.Fatalf("ack %+v does not link back to response %q", ack, resp.ID)
+	}
+}
+
+func TestEventIDsArePreserved(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", ID: "mine", CausedBy: "theirs"})
+	if e := recv(t, ch); e.ID != "mine" || e.CausedBy != "theirs" {
+		t.Fatalf("got %+v, want the ids as sent", e)
+	}
+}
@@ -0,0 +1,69 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestResetRunningLoop(t *testing.T) {
+	l := newLoop(t, nil)
+	if err := l.Reset(); err != waitloop.ErrLoopRunning {
+		t.Fatalf("got %v, want ErrLoopRunning", err)
+	}
+}
+
+func TestResetAfterTerminate(t *testing.T) {
+	l := newLoop(t, nil)
+	old := l.Wait("old")
+	l.Terminate()
+	stopped(t, l)
+	if e := recv(t, old); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+	done := l.Done()
+
+	if err := l.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if l.Done() == done {
+		t.Fatal("Done returned the previous run's channel")
+	}
+	select {
+	case <-l.Done():
+		t.Fatal("Done is closed after Reset")
+	default:
+	}
+
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+	if n := send(t, l, waitloop.Event{Key: "key", Data: 1}); n != 1 {
+		t.Fatalf("event reached %d listeners, want 1", n)
+	}
+	if e := recv(t, ch); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+
+	l.Terminate()
+	stopped(t, l)
+}
+
+func TestResetManualRun(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{ManualRun: true})
+	go l.RunLoop()
+	l.Terminate()
+	stopped(t, l)
+	if err := l.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if l.Ping(10 * time.Millisecond) {
+		t.Fatal("loop running before RunLoop")
+	}
+	go l.RunLoop()
+	if !l.Ping(patience) {
+		t.Fatal("loop not running after RunLoop")
+	}
+	// A second RunLoop returns at once instead of starting another run
+	l.RunLoop()
+}
@@ -0,0 +1,72 @@
+package waitloop
+
+import "time"
+
+type resumeToken struct {
+	key, token string
+}
+
+// resumable is the wait behind a WaitResumable token; it is only touched on the run goroutine
+type resumable struct {
+	out chan Event
+
+	// event is set once the event has arrived, and held until a resume collects it or until passes
+	event *Event
+	until time.Time
+}
+
+// WaitResumable is Wait for a client that may disconnect: calling it again with the same key and
+// token resumes the wait rather than starting another. If the event arrived in between, the new
+// channel receives it at once; otherwise the listener keeps waiting and the new channel takes over,
+// while the old one is cancelled with ErrCanceled (see LoopOptions.CloseSilentlyOnCancel)
+// An event is held for one TTL after it arrives, whether or not the old channel was read, so a
+// client that got it should not resume; a wait that timed out or was terminated is not held, and
+// resuming it starts a new one
+func (l *Loop) WaitResumable(key, token string) <-chan Event {
+	out := make(chan Event, 1)
+	lis := l.waitListener(key, 0)
+	if err := l.admit(lis); err != nil {
+		l.send(out, Event{Key: key, Error: err})
+		return out
+	}
+
+	id := resumeToken{key, token}
+	ok := l.exec(func() {
+		if r, ok := l.resumables[id]; ok {
+			if r.event != nil {
+				delete(l.resumables, id)
+				l.send(out, *r.event)
+				return
+			}
+			old := r.out
+			r.out = out
+			l.send(old, Event{Key: key, Error: ErrCanceled})
+			return
+		}
+
+		r := &resumable{out: out}
+		l.resumables[id] = r
+		lis.Handler = func(e Event) {
+			if e.Error == nil {
+				r.event, r.until = &e, l.now().Add(l.defaultTTL)
+			} else {
+				delete(l.resumables, id)
+			}
+			l.send(r.out, e)
+		}
+		l.registerListener(lis)
+	})
+	if !ok {
+		l.send(out, Event{Key: key, Error: ErrLoopTerminated})
+	}
+	return out
+}
+
+// pruneResumables forgets events that were held for a resume that never came
+func (l *Loop) pruneResumables(now time.Time) {
+	for id, r := range l.resumables {
+		if r.event != nil && r.until.Before(now) {
+			delete(l.resumables, id)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestWaitResumableWithoutAnEventInBetween(t *testing.T) {
+	l := newLoop(t, nil)
+	first := l.WaitResumable("key", "client")
+	waitListeners(t, l, 1)
+
+	// The client reconnects: the old channel is dropped and the same listener carries on
+	resumed := l.WaitResumable("key", "client")
+	cancelled(t, first, waitloop.ErrCanceled)
+	l.Ping(patience)
+	if n := l.ListenerCount(); n != 1 {
+		t.Fatalf("got %d listeners after resuming, want 1", n)
+	}
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	if e := recv(t, resumed); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+}
+
+func TestWaitResumableWithAnEventInBetween(t *testing.T) {
+	l := newLoop(t, nil)
+	l.WaitResumable("key", "client") // the client disconnects without reading it
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+
+	if e := recv(t, l.WaitResumable("key", "client")); e.Data != 1 {
+		t.Fatalf("got %v, want the event that arrived while disconnected", e.Data)
+	}
+	// Once collected, the token starts a fresh wait
+	again := l.WaitResumable("key", "client")
+	waitListeners(t, l, 1)
+	noRecv(t, again)
+	send(t, l, waitloop.Event{Key: "key", Data: 2})
+	if e := recv(t, again); e.Data != 2 {
+		t.Fatalf("got %v, want 2", e.Data)
+	}
+}
+
+func TestWaitResumableTokensAreSeparate(t *testing.T) {
+	l := newLoop(t, nil)
+	a := l.WaitResumable("key", "a")
+	b := l.WaitResumable("key", "b")
+	waitListeners(t, l, 2)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	recv(t, a)
+	recv(t, b)
+}
+
+func TestWaitResumableHeldEventExpires(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	l.WaitResumable("key", "client")
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+
+	advance(t, l, clock, 2*time.Minute)
+	resumed := l.WaitResumable("key", "client")
+	waitListeners(t, l, 1)
+	noRecv(t, resumed)
+}
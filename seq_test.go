@@ -0,0 +1,55 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestSeqCountsUpPerKey(t *testing.T) {
+	l := newLoop(t, nil)
+	a, b := l.WaitN("a", 3), l.WaitN("b", 1)
+	waitListeners(t, l, 2)
+
+	for i := 0; i < 3; i++ {
+		send(t, l, waitloop.Event{Key: "a"})
+	}
+	send(t, l, waitloop.Event{Key: "b"})
+	for want := uint64(1); want <= 3; want++ {
+		if e := recv(t, a); e.Seq != want {
+			t.Fatalf("got Seq %d, want %d", e.Seq, want)
+		}
+	}
+	if e := recv(t, b); e.Seq != 1 {
+		t.Fatalf("got Seq %d on another key, want 1", e.Seq)
+	}
+}
+
+func TestSeqOfAnIdleKeyIsForgotten(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	watched := l.WaitN("watched", 2)
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "idle"})
+	send(t, l, waitloop.Event{Key: "watched"})
+
+	// The watched key keeps its place while its listener waits, even without events
+	l.WaitTTL("watched", time.Hour)
+	waitListeners(t, l, 2)
+	advance(t, l, clock, 2*time.Minute)
+	recv(t, watched)
+	recv(t, watched) // ErrTimedOut
+
+	idle := l.Wait("idle")
+	waitListeners(t, l, 2)
+	send(t, l, waitloop.Event{Key: "idle"})
+	if e := recv(t, idle); e.Seq != 1 {
+		t.Fatalf("got Seq %d, want the idle key to start again from 1", e.Seq)
+	}
+	again := l.Wait("watched")
+	waitListeners(t, l, 2)
+	send(t, l, waitloop.Event{Key: "watched"})
+	if e := recv(t, again); e.Seq != 2 {
+		t.Fatalf("got Seq %d, want 2", e.Seq)
+	}
+}
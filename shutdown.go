@@ -0,0 +1,115 @@
+package waitloop
+
+import (
+	"context"
+	"sync"
+)
+
+// tracker counts goroutines in flight and signals when none are left
+type tracker struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{}
+}
+
+func (t *tracker) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.active++
+}
+
+func (t *tracker) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	if t.active == 0 {
+		close(t.idle)
+	}
+}
+
+// wait returns a channel that is closed once nothing is in flight
+func (t *tracker) wait() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	return t.idle
+}
+
+// ActiveDeliveries reports how many goroutines the loop has running to hand events to listeners;
+// listener channels are buffered, so it mostly counts hooks such as WaitFanOut handlers still running
+func (l *Loop) ActiveDeliveries() int {
+	l.inflight.mu.Lock()
+	defer l.inflight.mu.Unlock()
+	return l.inflight.active
+}
+
+// ShutdownSummary accounts for the listeners that were outstanding when Shutdown began
+type ShutdownSummary struct {
+	// Satisfied is how many were notified by events already sent when Shutdown was called
+	Satisfied int
+
+	// TimedOut is how many had already expired, and were timed out instead of terminated
+	TimedOut int
+
+	// Terminated is how many were still waiting, and received ErrLoopTerminated
+	Terminated int
+}
+
+// Shutdown drains the events already sent, times out listeners past their TTL and terminates the
+// loop, then waits until every listener has been handed its event, or until ctx is done, in
+// which case it terminates the loop and returns ctx.Err() along with what it had accounted for so
+// far; that includes a loop goroutine too busy to take the drain
+func (l *Loop) Shutdown(ctx context.Context) (ShutdownSummary, error) {
+	var summary ShutdownSummary
+	// drain runs on the run goroutine, and is only read once drained is closed
+	var drain ShutdownSummary
+	drained := make(chan struct{})
+	fn := func() {
+		defer close(drained)
+		drain.Satisfied = l.flushEvents()
+		if l.coalesceTimer != nil {
+			drain.Satisfied += l.releaseCoalesced(true)
+		}
+		if !l.cleanupPaused {
+			drain.TimedOut = l.cleanup()
+		}
+	}
+	if !l.isTerminated() {
+		select {
+		case l.commands <- fn:
+			select {
+			case <-drained:
+				summary = drain
+			case <-l.done:
+			case <-ctx.Done():
+				l.Terminate()
+				return summary, ctx.Err()
+			}
+		case <-l.done:
+		case <-ctx.Done():
+			l.Terminate()
+			return summary, ctx.Err()
+		}
+	}
+	l.Terminate()
+	select {
+	case <-l.done:
+		summary.Terminated = l.terminatedListeners
+	case <-ctx.Done():
+		return summary, ctx.Err()
+	}
+
+	select {
+	case <-l.inflight.wait():
+		return summary, nil
+	case <-ctx.Done():
+		return summary, ctx.Err()
+	}
+}
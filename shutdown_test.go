@@ -0,0 +1,175 @@
+package waitloop_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestShutdownReturnsAfterEveryListenerIsNotified(t *testing.T) {
+	const n = 1000
+	l := newLoop(t, nil)
+	chans := make([]<-chan waitloop.Event, n)
+	for i := range chans {
+		chans[i] = l.Wait(fmt.Sprint(i))
+	}
+	waitListeners(t, l, n)
+
+	ctx, cancel := context.WithTimeout(context.Background(), patience)
+	defer cancel()
+	summary, err := l.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Terminated != n {
+		t.Fatalf("got %+v, want %d terminated", summary, n)
+	}
+	for _, ch := range chans {
+		select {
+		case e := <-ch:
+			if e.Error != waitloop.ErrLoopTerminated {
+				t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+			}
+		default:
+			t.Fatal("Shutdown returned before a listener was notified")
+		}
+	}
+}
+
+func TestShutdownSummary(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, CleanupInterval: time.Hour})
+	expired := l.Wait("expired")
+	waiting := l.WaitTTL("waiting", 2*time.Hour)
+	waitListeners(t, l, 2)
+	// Past the first TTL, but before any cleanup pass
+	clock.Advance(2 * time.Minute)
+
+	summary, err := l.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (waitloop.ShutdownSummary{TimedOut: 1, Terminated: 1}); summary != want {
+		t.Fatalf("got %+v, want %+v", summary, want)
+	}
+	if e := recv(t, expired); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+	if e := recv(t, waiting); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+}
+
+func TestShutdownRespectsDeadline(t *testing.T) {
+	l := newLoop(t, nil)
+	block := make(chan struct{})
+	defer close(block)
+	// A fan-out handler that is still running holds Shutdown up
+	l.WaitFanOut("key", func(waitloop.Event) { <-block })
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	stopped(t, l)
+}
+
+func TestActiveDeliveriesCountsRunningHandlers(t *testing.T) {
+	l := newLoop(t, nil)
+	release := make(chan struct{})
+	handler := func(waitloop.Event) { release <- struct{}{} }
+	l.WaitFanOut("key", handler, handler, handler)
+	waitListeners(t, l, 1)
+	if n := l.ActiveDeliveries(); n != 0 {
+		t.Fatalf("got %d active deliveries before any event", n)
+	}
+
+	send(t, l, waitloop.Event{Key: "key"})
+	waitUntil(t, "the handlers to start", func() bool { return l.ActiveDeliveries() == 3 })
+	<-release
+	waitUntil(t, "one handler to finish", func() bool { return l.ActiveDeliveries() == 2 })
+	<-release
+	<-release
+	waitUntil(t, "every handler to finish", func() bool { return l.ActiveDeliveries() == 0 })
+}
+
+func TestShutdownSummaryOfEveryOutcome(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, CleanupInterval: time.Hour, CoalesceWindow: time.Hour})
+	satisfied := []<-chan waitloop.Event{l.WaitTTL("sat", 2*time.Hour), l.WaitTTL("sat", 2*time.Hour)}
+	expired := l.Wait("old")
+	live := l.WaitTTL("live", 2*time.Hour)
+	waitListeners(t, l, 4)
+
+	// An event held in its coalescing window is one already sent, which Shutdown delivers
+	l.Send(waitloop.Event{Key: "sat", Data: 1})
+	waitUntil(t, "the event to be held", func() bool { return l.SentEvents() == 1 && l.ChannelStats().EventsLen == 0 })
+	l.Ping(patience)
+	clock.Advance(2 * time.Minute)
+
+	summary, err := l.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (waitloop.ShutdownSummary{Satisfied: 2, TimedOut: 1, Terminated: 1}); summary != want {
+		t.Fatalf("got %+v, want %+v", summary, want)
+	}
+	for _, ch := range satisfied {
+		if e := recv(t, ch); e.Data != 1 {
+			t.Fatalf("got %+v, want the held event", e)
+		}
+	}
+	if e := recv(t, expired); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+	if e := recv(t, live); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+}
+
+func TestShutdownRespectsDeadlineWhileTheLoopIsBusy(t *testing.T) {
+	// The loop gets stuck in OnFire either before Shutdown can hand it the drain, or, with the
+	// event held by CoalesceWindow until the drain releases it, while the drain is running
+	for _, duringDrain := range []bool{false, true} {
+		t.Run(fmt.Sprint("during drain ", duringDrain), func(t *testing.T) {
+			entered, release := make(chan struct{}, 1), make(chan struct{})
+			defer close(release)
+			options := &waitloop.LoopOptions{OnFire: func(string, int) {
+				entered <- struct{}{}
+				<-release
+			}}
+			if duringDrain {
+				options.CoalesceWindow = time.Hour
+			}
+			l := newLoop(t, options)
+			l.Wait("key")
+			waitListeners(t, l, 1)
+			l.Send(waitloop.Event{Key: "key"})
+			if duringDrain {
+				waitUntil(t, "the event to be held", func() bool { return l.ChannelStats().EventsLen == 0 })
+			} else {
+				<-entered
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			returned := make(chan error, 1)
+			go func() {
+				_, err := l.Shutdown(ctx)
+				returned <- err
+			}()
+			select {
+			case err := <-returned:
+				if err != context.DeadlineExceeded {
+					t.Fatalf("got %v, want context.DeadlineExceeded", err)
+				}
+			case <-time.After(patience):
+				t.Fatal("Shutdown ignored its deadline while the loop was busy")
+			}
+		})
+	}
+}
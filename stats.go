@@ -0,0 +1,83 @@
+package waitloop
+
+import (
+	"sort"
+	"time"
+)
+
+// waitSampleSize is how many recent wait durations are kept per key for percentiles
+const waitSampleSize = 128
+
+// DurationStats summarizes how long listeners on a key waited for their event
+// Mean covers every delivery; P95 covers the most recent ones
+type DurationStats struct {
+	Count uint64
+	Mean  time.Duration
+	P95   time.Duration
+}
+
+type waitSummary struct {
+	count   uint64
+	total   time.Duration
+	samples []time.Duration
+	next    int
+	updated time.Time
+}
+
+func (s *waitSummary) add(d time.Duration, now time.Time) {
+	s.count++
+	s.total += d
+	s.updated = now
+	if len(s.samples) < waitSampleSize {
+		s.samples = append(s.samples, d)
+		return
+	}
+	s.samples[s.next] = d
+	s.next = (s.next + 1) % waitSampleSize
+}
+
+func (s *waitSummary) stats() DurationStats {
+	sorted := append([]time.Duration{}, s.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return DurationStats{
+		Count: s.count,
+		Mean:  s.total / time.Duration(s.count),
+		P95:   sorted[(len(sorted)*95-1)/100],
+	}
+}
+
+// WaitDurationStats reports how long listeners on key waited between registration and delivery
+// Keys with no deliveries for a full TTL are forgotten
+func (l *Loop) WaitDurationStats(key string) DurationStats {
+	result := make(chan DurationStats, 1)
+	ok := l.exec(func() {
+		if s, ok := l.waitStats[key]; ok {
+			result <- s.stats()
+		} else {
+			result <- DurationStats{}
+		}
+	})
+	if !ok {
+		return DurationStats{}
+	}
+	return <-result
+}
+
+func (l *Loop) recordWait(lis listener) {
+	now := l.now()
+	s, ok := l.waitStats[lis.Key]
+	if !ok {
+		s = &waitSummary{}
+		l.waitStats[lis.Key] = s
+	}
+	s.add(now.Sub(lis.Registered), now)
+}
+
+func (l *Loop) pruneWaitStats() {
+	cutoff := l.now().Add(-l.defaultTTL)
+	for key, s := range l.waitStats {
+		if s.updated.Before(cutoff) {
+			delete(l.waitStats, key)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+	"github.com/fsufitch/waitloop/fakeclock"
+)
+
+// waitFor registers a wait on key, lets d pass on clock and fires it
+func waitFor(t *testing.T, l *waitloop.Loop, clock *fakeclock.Clock, key string, d time.Duration) {
+	t.Helper()
+	ch := l.Wait(key)
+	waitListeners(t, l, 1)
+	clock.Advance(d)
+	send(t, l, waitloop.Event{Key: key})
+	recv(t, ch)
+}
+
+func TestWaitDurationStats(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Hour})
+	if got := l.WaitDurationStats("key"); got != (waitloop.DurationStats{}) {
+		t.Fatalf("got %+v before any wait, want zero", got)
+	}
+
+	waitFor(t, l, clock, "key", 10*time.Second)
+	waitFor(t, l, clock, "key", 30*time.Second)
+	waitFor(t, l, clock, "other", time.Minute)
+
+	want := waitloop.DurationStats{Count: 2, Mean: 20 * time.Second, P95: 30 * time.Second}
+	if got := l.WaitDurationStats("key"); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestWaitDurationStatsPrunedWhenIdle(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	waitFor(t, l, clock, "key", time.Second)
+	advance(t, l, clock, 2*time.Minute)
+	if got := l.WaitDurationStats("key"); got.Count != 0 {
+		t.Fatalf("got %+v after a TTL without deliveries, want zero", got)
+	}
+}
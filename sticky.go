@@ -0,0 +1,62 @@
+package waitloop
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// stickyEvent is an event held under LoopOptions.StickyTTL for a listener that arrives late
+type stickyEvent struct {
+	event Event
+	until time.Time
+}
+
+// stick holds e for the next listener on its key, if sticky events are enabled
+func (l *Loop) stick(e Event) {
+	if l.stickyTTL <= 0 {
+		return
+	}
+	l.sticky[e.Key] = stickyEvent{event: e, until: l.now().Add(l.stickyTTL)}
+}
+
+// takeSticky hands lis the event held for its key, if there is one its Filter accepts, and
+// reports whether that finished it; a persistent listener, or one taking several events, gets the
+// event and still needs registering. An event the filter rejects stays held for the next listener
+func (l *Loop) takeSticky(lis *listener) bool {
+	held, ok := l.sticky[lis.Key]
+	if !ok {
+		return false
+	}
+	if l.now().After(held.until) {
+		delete(l.sticky, lis.Key)
+		return false
+	}
+	switch accepted, failed := lis.accepts(held.event); {
+	case failed:
+		l.deliver(*lis, Event{Key: lis.Key, Error: ErrFilterPanic})
+		return true
+	case !accepted:
+		return false
+	}
+	delete(l.sticky, lis.Key)
+
+	atomic.AddUint64(&l.counters.delivered, 1)
+	if lis.Persistent || lis.Remaining > 1 {
+		lis.Handler(held.event)
+		if lis.Remaining > 1 {
+			lis.Remaining--
+		}
+		return false
+	}
+	lis.Bytes = 0 // never counted
+	l.deliver(*lis, held.event)
+	return true
+}
+
+func (l *Loop) pruneSticky(now time.Time) {
+	for key, held := range l.sticky {
+		if now.After(held.until) {
+			delete(l.sticky, key)
+		}
+	}
+}
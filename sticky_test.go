@@ -0,0 +1,101 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestStickyEventReachesALateListener(t *testing.T) {
+	l, _ := newFakeLoop(t, &waitloop.LoopOptions{StickyTTL: time.Minute})
+	if n := send(t, l, waitloop.Event{Key: "key", Data: 1}); n != 0 {
+		t.Fatalf("event reached %d listeners, want 0", n)
+	}
+	if e := recv(t, l.Wait("key")); e.Data != 1 {
+		t.Fatalf("got %v, want the held event", e.Data)
+	}
+	// It is only handed out once
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+	noRecv(t, ch)
+}
+
+func TestStickyEventExpires(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{StickyTTL: time.Minute})
+	send(t, l, waitloop.Event{Key: "key"})
+	advance(t, l, clock, time.Minute+time.Second)
+
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+	noRecv(t, ch)
+}
+
+func TestStickyEventRespectsFilter(t *testing.T) {
+	l, _ := newFakeLoop(t, &waitloop.LoopOptions{StickyTTL: time.Minute})
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+
+	rejecting := l.WaitFilter("key", func(e waitloop.Event) bool { return e.Data != 1 })
+	waitListeners(t, l, 1)
+	noRecv(t, rejecting)
+
+	// The rejected event is still held for the next listener
+	accepting := l.WaitFilter("key", func(e waitloop.Event) bool { return e.Data == 1 })
+	if e := recv(t, accepting); e.Data != 1 {
+		t.Fatalf("got %v, want the held event", e.Data)
+	}
+	if n := l.ListenerCount(); n != 1 {
+		t.Fatalf("%d listeners left, want only the rejecting one", n)
+	}
+}
+
+func TestStickyHoldsTheLastEventPerKey(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{StickyTTL: time.Minute})
+	send(t, l, waitloop.Event{Key: "a", Data: 1})
+	send(t, l, waitloop.Event{Key: "a", Data: 2})
+	send(t, l, waitloop.Event{Key: "b", Data: 3})
+
+	// Still inside the window
+	advance(t, l, clock, 59*time.Second)
+	if e := recv(t, l.Wait("a")); e.Data != 2 {
+		t.Fatalf("got %v, want the last event on a", e.Data)
+	}
+	if e := recv(t, l.Wait("b")); e.Data != 3 {
+		t.Fatalf("got %v, want b's event", e.Data)
+	}
+}
+
+func TestStickyOnlyHoldsUnclaimedEvents(t *testing.T) {
+	l, _ := newFakeLoop(t, &waitloop.LoopOptions{StickyTTL: time.Minute})
+	first := l.Wait("key")
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	recv(t, first)
+
+	late := l.Wait("key")
+	waitListeners(t, l, 1)
+	noRecv(t, late)
+}
+
+func TestStickyEventsOutliveAFinishedGroup(t *testing.T) {
+	l, _ := newFakeLoop(t, &waitloop.LoopOptions{StickyTTL: time.Minute})
+	send(t, l, waitloop.Event{Key: "a", Data: 1})
+	send(t, l, waitloop.Event{Key: "b", Data: 2})
+	send(t, l, waitloop.Event{Key: "job", Data: 3})
+	send(t, l, waitloop.Event{Key: "stop", Data: 4})
+
+	if e := recv(t, l.WaitAny("a", "b")); e.Key != "a" {
+		t.Fatalf("WaitAny got %+v, want the event on a", e)
+	}
+	if e := recv(t, l.WaitUnless("job", "stop")); e.Key != "job" || e.Error != nil {
+		t.Fatalf("WaitUnless got %+v, want the event on job", e)
+	}
+	// Siblings of a group that was already settled never took the events held for their keys
+	waitListeners(t, l, 0)
+	if e := recv(t, l.Wait("b")); e.Data != 2 {
+		t.Fatalf("got %v, want the event held for b", e.Data)
+	}
+	if e := recv(t, l.Wait("stop")); e.Data != 4 {
+		t.Fatalf("got %v, want the event held for stop", e.Data)
+	}
+}
@@ -0,0 +1,305 @@
+package waitloop
+
+import (
+	"sync"
+	"time"
+)
+
+// mailbox queues events for a persistent subscription and hands them to its channel in order,
+// so that run never waits on a slow subscriber
+type mailbox struct {
+	mu    sync.Mutex
+	queue []Event
+	ended bool
+	wake  chan struct{}
+	stop  chan struct{}
+	once  sync.Once
+	out   chan Event
+}
+
+func newMailbox() *mailbox {
+	m := &mailbox{
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		out:  make(chan Event),
+	}
+	go m.pump()
+	return m
+}
+
+func (m *mailbox) put(e Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ended {
+		return
+	}
+	m.queue = append(m.queue, e)
+	m.signal()
+}
+
+// end queues a final event, after which the channel is closed
+func (m *mailbox) end(final Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ended {
+		return
+	}
+	m.queue = append(m.queue, final)
+	m.ended = true
+	m.signal()
+}
+
+// finish closes the channel once everything already queued has been delivered
+func (m *mailbox) finish() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ended = true
+	m.signal()
+}
+
+// close closes the channel at once, dropping anything still queued
+func (m *mailbox) close() {
+	m.once.Do(func() { close(m.stop) })
+}
+
+func (m *mailbox) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *mailbox) pump() {
+	defer close(m.out)
+	for {
+		m.mu.Lock()
+		batch, ended := m.queue, m.ended
+		m.queue = nil
+		m.mu.Unlock()
+
+		for _, e := range batch {
+			select {
+			case m.out <- e:
+			case <-m.stop:
+				return
+			}
+		}
+		if ended {
+			return
+		}
+
+		select {
+		case <-m.wake:
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// subscribe registers a persistent listener on each distinct key, all feeding one channel
+// The subscription lasts until the returned func is called, which closes the channel, or until
+// the loop terminates, which sends a final ErrLoopTerminated Event first
+func (l *Loop) subscribe(keys []string) (<-chan Event, func()) {
+	m := newMailbox()
+	ids := map[uint64]string{}
+	var listeners []listener
+
+	// ended is only touched on the run goroutine
+	ended := false
+	end := func(key string, err error) {
+		if ended {
+			return
+		}
+		ended = true
+		for id, k := range ids {
+			l.removeListener(k, id)
+		}
+		m.end(Event{Key: key, Error: err})
+	}
+
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		lis := l.newListener(key, 0)
+		lis.Expiration = time.Time{}
+		lis.Persistent = true
+		lis.Handler = m.put
+		key := key
+		lis.End = func(err error) { end(key, err) }
+		ids[lis.ID] = key
+		listeners = append(listeners, lis)
+	}
+
+	if err := l.admit(listeners...); err != nil {
+		m.end(Event{Error: err})
+	} else if !l.exec(func() {
+		for _, lis := range listeners {
+			l.registerListener(lis)
+		}
+	}) {
+		m.end(Event{Error: ErrLoopTerminated})
+	}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			l.exec(func() {
+				ended = true
+				for id, k := range ids {
+					l.removeListener(k, id)
+				}
+			})
+			m.close()
+		})
+	}
+	return m.out, cancel
+}
+
+// SubscribeSet subscribes to every event on any of keys, delivered on one channel until the
+// returned cancel func is called; unlike Wait, the listeners do not expire or end after an event
+// When the loop terminates, a final ErrLoopTerminated Event is sent before the channel closes
+func (l *Loop) SubscribeSet(keys []string) (<-chan Event, func()) {
+	return l.subscribe(keys)
+}
+
+// SubscribeThrottled is a subscription to key that wakes the caller at most once per
+// minInterval, as measured by LoopOptions.Clock: events arriving faster are coalesced, and only
+// the latest of each window is delivered, once the window ends, or straight away if the
+// subscription ends first, ahead of its final error Event
+func (l *Loop) SubscribeThrottled(key string, minInterval time.Duration) (<-chan Event, func()) {
+	in, unsubscribe := l.subscribe([]string{key})
+	out := make(chan Event)
+	stop := make(chan struct{})
+
+	go func() {
+		defer close(out)
+		var (
+			latest  Event
+			pending bool
+			timer   Timer
+			window  <-chan time.Time
+		)
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			var send chan Event
+			if pending && window == nil {
+				send = out
+			}
+
+			select {
+			case e, ok := <-in:
+				if !ok {
+					return
+				}
+				if e.Error != nil {
+					// The subscription is over: the held event goes out at once, ahead of the final one
+					if pending {
+						select {
+						case out <- latest:
+						case <-stop:
+							return
+						}
+					}
+					select {
+					case out <- e:
+					case <-stop:
+					}
+					return
+				}
+				latest, pending = e, true
+			case <-window:
+				window = nil
+			case send <- latest:
+				pending = false
+				if timer == nil {
+					timer = l.clock.NewTimer(minInterval)
+				} else {
+					timer.Reset(minInterval)
+				}
+				window = timer.C()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(stop)
+			unsubscribe()
+		})
+	}
+	return out, cancel
+}
+
+// Subscribe calls fn with every event on key until the returned unsubscribe func is called, or
+// until the loop terminates, in which case fn gets one final ErrLoopTerminated Event
+// fn runs on a goroutine of the subscription's own, one call at a time and in the order the events
+// were processed, so a slow fn delays only its own subscription; once unsubscribe returns, fn is
+// not called again, though a call already under way may still be running
+func (l *Loop) Subscribe(key string, fn func(Event)) (unsubscribe func()) {
+	in, cancel := l.subscribe([]string{key})
+	stop := make(chan struct{})
+
+	l.spawn(func() {
+		for e := range in {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			fn(e)
+		}
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			cancel()
+		})
+	}
+}
+
+// WaitN is Wait for up to n events on key: each arrives on the returned channel, which is closed
+// after the nth. The TTL covers the whole wait, so if it runs out, or the loop terminates, first,
+// the channel gets that error after the events so far; n <= 0 returns a closed channel. The
+// channel is buffered to hold all n events and that error, so it need not be read at all
+func (l *Loop) WaitN(key string, n int) <-chan Event {
+	if n <= 0 {
+		out := make(chan Event)
+		close(out)
+		return out
+	}
+
+	out := make(chan Event, n+1)
+	lis := l.waitListener(key, 0)
+	lis.Remaining = n
+	// received is only touched on the run goroutine
+	received := 0
+	lis.Handler = func(e Event) {
+		if e.Error == nil {
+			out <- e
+			if received++; received == n {
+				close(out)
+			}
+			return
+		}
+		// Like send, whatever ends the wait early is kept for CloseCause
+		l.causes.record(out, e.Error, l.now())
+		if !canceled(e.Error) || !l.closeOnCancel {
+			out <- e
+		}
+		close(out)
+	}
+	l.register(lis)
+	return out
+}
@@ -0,0 +1,187 @@
+package waitloop_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestSubscribeSetMultiplexesKeys(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	ch, cancel := l.SubscribeSet([]string{"a", "b", "a", "c"})
+	defer cancel()
+	waitListeners(t, l, 3)
+
+	for i, key := range []string{"b", "a", "other", "c", "a"} {
+		send(t, l, waitloop.Event{Key: key, Data: i})
+	}
+	for _, want := range []int{0, 1, 3, 4} {
+		if e := recv(t, ch); e.Data != want {
+			t.Fatalf("got %+v, want event %d", e, want)
+		}
+	}
+	noRecv(t, ch)
+
+	// The subscription outlives the TTL
+	advance(t, l, clock, 2*time.Minute)
+	noRecv(t, ch)
+	send(t, l, waitloop.Event{Key: "c", Data: 5})
+	if e := recv(t, ch); e.Data != 5 {
+		t.Fatalf("got %+v, want event 5", e)
+	}
+}
+
+func TestSubscribeSetCancelStopsEveryKey(t *testing.T) {
+	l := newLoop(t, nil)
+	ch, cancel := l.SubscribeSet([]string{"a", "b"})
+	waitListeners(t, l, 2)
+
+	cancel()
+	closed(t, ch)
+	waitListeners(t, l, 0)
+	for _, key := range []string{"a", "b"} {
+		if n := send(t, l, waitloop.Event{Key: key}); n != 0 {
+			t.Fatalf("event on %s reached %d listeners after cancel", key, n)
+		}
+	}
+	// Cancelling twice is harmless
+	cancel()
+}
+
+func TestSubscribeSetTerminate(t *testing.T) {
+	l := newLoop(t, nil)
+	ch, cancel := l.SubscribeSet([]string{"a", "b"})
+	defer cancel()
+	waitListeners(t, l, 2)
+
+	l.Terminate()
+	// One final event for the whole subscription, not one per key
+	if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %+v, want ErrLoopTerminated", e)
+	}
+	closed(t, ch)
+}
+
+func TestSubscribeThrottledDeliversTheLatestPerInterval(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{CleanupInterval: time.Hour})
+	ch, cancel := l.SubscribeThrottled("key", time.Second)
+	waitListeners(t, l, 1)
+
+	// The first event opens a window at once
+	send(t, l, waitloop.Event{Key: "key", Data: 0})
+	if e := recv(t, ch); e.Data != 0 {
+		t.Fatalf("got %v, want 0", e.Data)
+	}
+	for i := 1; i <= 3; i++ {
+		send(t, l, waitloop.Event{Key: "key", Data: i})
+	}
+	noRecv(t, ch)
+
+	// The cleanup ticker and the window
+	waitUntil(t, "the window to open", func() bool { return clock.Pending() == 2 })
+	clock.Advance(time.Second)
+	if e := recv(t, ch); e.Data != 3 {
+		t.Fatalf("got %v, want the latest of the burst", e.Data)
+	}
+	noRecv(t, ch)
+
+	// A quiet window passes, and the next event is delivered straight away
+	waitUntil(t, "the next window to open", func() bool { return clock.Pending() == 2 })
+	clock.Advance(time.Second)
+	waitUntil(t, "the window to close", clock.Delivered)
+	noRecv(t, ch)
+	send(t, l, waitloop.Event{Key: "key", Data: 4})
+	if e := recv(t, ch); e.Data != 4 {
+		t.Fatalf("got %v, want 4", e.Data)
+	}
+
+	cancel()
+	closed(t, ch)
+	waitListeners(t, l, 0)
+}
+
+func TestSubscribeThrottledTerminate(t *testing.T) {
+	l := newLoop(t, nil)
+	ch, cancel := l.SubscribeThrottled("key", time.Hour)
+	defer cancel()
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", Data: 0})
+	recv(t, ch)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	send(t, l, waitloop.Event{Key: "key", Data: 2})
+
+	// Neither the latest of the burst nor the final event is held back by the window
+	l.Terminate()
+	if e := recv(t, ch); e.Data != 2 || e.Error != nil {
+		t.Fatalf("got %+v, want the latest of the burst", e)
+	}
+	if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %+v, want ErrLoopTerminated", e)
+	}
+	closed(t, ch)
+}
+
+func TestSubscribeDeliversEveryEventInOrder(t *testing.T) {
+	l := newLoop(t, nil)
+	got := make(chan waitloop.Event, 10)
+	var running, overlapped int32
+	unsubscribe := l.Subscribe("key", func(e waitloop.Event) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		got <- e
+	})
+	defer unsubscribe()
+	waitListeners(t, l, 1)
+
+	for i := 0; i < 5; i++ {
+		send(t, l, waitloop.Event{Key: "key", Data: i})
+	}
+	for i := 0; i < 5; i++ {
+		if e := recv(t, got); e.Data != i {
+			t.Fatalf("got %v, want %d", e.Data, i)
+		}
+	}
+	if atomic.LoadInt32(&overlapped) != 0 {
+		t.Fatal("fn ran concurrently with itself")
+	}
+	if n := l.ListenerCount(); n != 1 {
+		t.Fatalf("got %d listeners, want the subscription to persist", n)
+	}
+}
+
+func TestSubscribeUnsubscribe(t *testing.T) {
+	l := newLoop(t, nil)
+	got := make(chan waitloop.Event, 10)
+	unsubscribe := l.Subscribe("key", func(e waitloop.Event) { got <- e })
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	recv(t, got)
+
+	unsubscribe()
+	unsubscribe()
+	waitListeners(t, l, 0)
+	send(t, l, waitloop.Event{Key: "key", Data: 2})
+	// Unsubscribing is not a termination, so there's no final event either
+	l.Terminate()
+	stopped(t, l)
+	noRecv(t, got)
+}
+
+func TestSubscribeTerminate(t *testing.T) {
+	l := newLoop(t, nil)
+	got := make(chan waitloop.Event, 10)
+	unsubscribe := l.Subscribe("key", func(e waitloop.Event) { got <- e })
+	defer unsubscribe()
+	waitListeners(t, l, 1)
+
+	l.Terminate()
+	if e := recv(t, got); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %+v, want ErrLoopTerminated", e)
+	}
+	noRecv(t, got)
+}
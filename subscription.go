@@ -0,0 +1,50 @@
+package waitloop
+
+import "sync"
+
+// Subscription bundles a listener channel with the state of the wait behind it
+type Subscription struct {
+	c      chan Event
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// C returns the channel on which the subscription's events arrive
+func (s *Subscription) C() <-chan Event {
+	return s.c
+}
+
+// Err returns the terminal error of the subscription (ErrTimedOut, ErrLoopTerminated, ...), or
+// nil while it is open or if it ended with a normal event
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Closed reports whether the subscription has ended; its last event may still be unread on C
+func (s *Subscription) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Subscription) end(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	s.closed = true
+}
+
+// WaitSubscription is Wait returning a Subscription instead of a bare channel
+func (l *Loop) WaitSubscription(key string) *Subscription {
+	s := &Subscription{c: make(chan Event, 1)}
+	lis := l.waitListener(key, 0)
+	lis.Handler = func(e Event) {
+		s.end(e.Error)
+		l.send(s.c, e)
+	}
+	l.register(lis)
+	return s
+}
@@ -0,0 +1,47 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestSubscriptionAccessors(t *testing.T) {
+	t.Run("delivery", func(t *testing.T) {
+		l := newLoop(t, nil)
+		s := l.WaitSubscription("key")
+		waitListeners(t, l, 1)
+		if s.Closed() || s.Err() != nil {
+			t.Fatalf("open subscription reports closed %v, err %v", s.Closed(), s.Err())
+		}
+		send(t, l, waitloop.Event{Key: "key", Data: 1})
+		if e := recv(t, s.C()); e.Data != 1 {
+			t.Fatalf("got %v, want 1", e.Data)
+		}
+		closed(t, s.C())
+		if !s.Closed() || s.Err() != nil {
+			t.Fatalf("delivered subscription reports closed %v, err %v", s.Closed(), s.Err())
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+		s := l.WaitSubscription("key")
+		waitListeners(t, l, 1)
+		advance(t, l, clock, 2*time.Minute)
+		recv(t, s.C())
+		if !s.Closed() || s.Err() != waitloop.ErrTimedOut {
+			t.Fatalf("timed out subscription reports closed %v, err %v", s.Closed(), s.Err())
+		}
+	})
+	t.Run("terminate", func(t *testing.T) {
+		l := newLoop(t, nil)
+		s := l.WaitSubscription("key")
+		waitListeners(t, l, 1)
+		l.Terminate()
+		recv(t, s.C())
+		if !s.Closed() || s.Err() != waitloop.ErrLoopTerminated {
+			t.Fatalf("terminated subscription reports closed %v, err %v", s.Closed(), s.Err())
+		}
+	})
+}
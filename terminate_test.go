@@ -0,0 +1,304 @@
+package waitloop_test
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestTerminateNotifiesEveryListener(t *testing.T) {
+	l := newLoop(t, nil)
+	var chans []<-chan waitloop.Event
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 3; j++ {
+			chans = append(chans, l.Wait(fmt.Sprint(i)))
+		}
+	}
+	waitListeners(t, l, len(chans))
+
+	l.Terminate()
+	for _, ch := range chans {
+		if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+			t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+		}
+		closed(t, ch)
+	}
+	stopped(t, l)
+	if n := l.ListenerCount(); n != 0 {
+		t.Fatalf("%d listeners left", n)
+	}
+}
+
+func TestTerminateRacingRegistrations(t *testing.T) {
+	for run := 0; run < 20; run++ {
+		l := newLoop(t, &waitloop.LoopOptions{IncomingChannelSize: 64})
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			chans []<-chan waitloop.Event
+			acks  []<-chan int
+		)
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					key := fmt.Sprint(g, i)
+					ch, ack := l.Wait(key), l.SendAck(waitloop.Event{Key: "other"})
+					mu.Lock()
+					chans, acks = append(chans, ch), append(acks, ack)
+					mu.Unlock()
+				}
+			}(g)
+		}
+		l.Terminate()
+		wg.Wait()
+
+		// Every listener hears something, and every acknowledgement settles, however the race went
+		for _, ch := range chans {
+			if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+				t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+			}
+		}
+		for _, ack := range acks {
+			select {
+			case <-ack:
+			case <-l.Done():
+				<-ack
+			}
+		}
+	}
+}
+
+func TestWaitErrLiveLoop(t *testing.T) {
+	l := newLoop(t, nil)
+	ch, err := l.WaitErr("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	if e := recv(t, ch); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+}
+
+func TestWaitErrTerminatedLoop(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Terminate()
+	stopped(t, l)
+
+	before := runtime.NumGoroutine()
+	ch, err := l.WaitErr("key")
+	if err != waitloop.ErrLoopTerminated || ch != nil {
+		t.Fatalf("got %v, %v; want a nil channel and ErrLoopTerminated", ch, err)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("WaitErr left %d goroutines behind", after-before)
+	}
+}
+
+// Run under -race: the terminated flag is written by the run goroutine and read by every caller
+func TestTerminateRacingSendsAndWaits(t *testing.T) {
+	l := newLoop(t, nil)
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprint(g, i%10)
+				switch i % 4 {
+				case 0:
+					l.Send(waitloop.Event{Key: key})
+				case 1:
+					l.TrySend(waitloop.Event{Key: key})
+				case 2:
+					l.Wait(key)
+				case 3:
+					l.WaitTTL(key, time.Minute)
+				}
+			}
+		}(g)
+	}
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Terminate()
+		}()
+	}
+	stopped(t, l)
+	close(stop)
+	wg.Wait()
+
+	// Once terminated, the fast paths answer at once
+	if err := l.Send(waitloop.Event{Key: "key"}); err != waitloop.ErrLoopTerminated {
+		t.Fatalf("Send got %v, want ErrLoopTerminated", err)
+	}
+	if e := recv(t, l.WaitTTL("key", time.Minute)); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("WaitTTL got %v, want ErrLoopTerminated", e.Error)
+	}
+}
+
+func TestSendAfterTerminate(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Terminate()
+	stopped(t, l)
+	if err := l.Send(waitloop.Event{Key: "key"}); err != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", err)
+	}
+	if _, ok := <-l.SendAck(waitloop.Event{Key: "key"}); ok {
+		t.Fatal("acknowledgement of an event sent after termination was not closed")
+	}
+	if n := l.DroppedEvents(); n != 2 {
+		t.Fatalf("got %d dropped events, want 2", n)
+	}
+}
+
+func TestSendIntoAFullBufferDuringTerminate(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{IncomingChannelSize: 1})
+	entered, release := make(chan struct{}), make(chan struct{})
+	l.WaitWithRemoveHook("block", func(error) {
+		close(entered)
+		<-release
+	})
+	waitListeners(t, l, 1)
+	l.Send(waitloop.Event{Key: "block"})
+	<-entered
+	// The run goroutine is held up, so this fills the buffer and the next send blocks
+	if err := l.Send(waitloop.Event{Key: "filler"}); err != nil {
+		t.Fatal(err)
+	}
+	returned := make(chan error)
+	go func() { returned <- l.Send(waitloop.Event{Key: "blocked"}) }()
+	select {
+	case err := <-returned:
+		t.Fatalf("Send into a full buffer returned %v without blocking", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.Terminate()
+	close(release)
+	select {
+	case err := <-returned:
+		// The blocked event may have slipped into the buffer before the loop saw Terminate
+		if err != nil && err != waitloop.ErrLoopTerminated {
+			t.Fatalf("got %v, want nil or ErrLoopTerminated", err)
+		}
+	case <-time.After(patience):
+		t.Fatal("Send into a full buffer deadlocked after Terminate")
+	}
+	stopped(t, l)
+	if err := l.Send(waitloop.Event{Key: "after"}); err != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", err)
+	}
+}
+
+func TestDoneClosesAfterEveryListenerIsNotified(t *testing.T) {
+	l := newLoop(t, nil)
+	done := l.Done()
+	if l.Done() != done {
+		t.Fatal("Done returned a different channel on a second call")
+	}
+	var chans []<-chan waitloop.Event
+	for i := 0; i < 20; i++ {
+		chans = append(chans, l.Wait(fmt.Sprint(i%4)))
+	}
+	waitListeners(t, l, len(chans))
+	select {
+	case <-done:
+		t.Fatal("Done closed before Terminate")
+	default:
+	}
+
+	l.Terminate()
+	stopped(t, l)
+	if l.Done() != done {
+		t.Fatal("Done returned a different channel after termination")
+	}
+	// By the time Done closes every notification has been delivered, so none of these block
+	for i, ch := range chans {
+		select {
+		case e := <-ch:
+			if e.Error != waitloop.ErrLoopTerminated {
+				t.Fatalf("listener %d got %v, want ErrLoopTerminated", i, e.Error)
+			}
+		default:
+			t.Fatalf("listener %d not notified when Done closed", i)
+		}
+	}
+}
+
+func TestDoneWaitsForABatchOfTimeouts(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	chans := make([]<-chan waitloop.Event, 20000)
+	for i := range chans {
+		chans[i] = l.Wait(fmt.Sprint(i))
+	}
+	waitListeners(t, l, len(chans))
+
+	// The timeouts go out on a goroutine of their own, which Done must wait for in full
+	advance(t, l, clock, 2*time.Minute)
+	l.Terminate()
+	stopped(t, l)
+	for i, ch := range chans {
+		select {
+		case e := <-ch:
+			if e.Error != waitloop.ErrTimedOut {
+				t.Fatalf("listener %d got %v, want ErrTimedOut", i, e.Error)
+			}
+		default:
+			t.Fatalf("listener %d not notified when Done closed", i)
+		}
+	}
+}
+
+func TestTerminateFromManyGoroutines(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{DetectDoubleDelivery: true})
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			l.Terminate()
+		}()
+	}
+	close(start)
+	returned := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(patience):
+		t.Fatal("Terminate blocked")
+	}
+	stopped(t, l)
+
+	// The listener was terminated once, and later calls still return at once
+	if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+	closed(t, ch)
+	l.Terminate()
+	if n := l.Stats().Terminated; n != 1 {
+		t.Fatalf("got %d terminated listeners, want 1", n)
+	}
+}
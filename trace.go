@@ -0,0 +1,66 @@
+package waitloop
+
+import "time"
+
+// TraceKind is a step in the life of a traced wait
+type TraceKind int
+
+const (
+	// TraceRegistered is reported when the listener is added to the loop
+	TraceRegistered TraceKind = iota
+	// TraceCleanupSkipped is reported for each cleanup pass that finds the listener not yet expired
+	TraceCleanupSkipped
+	// TraceFired is reported when an event is delivered to the listener
+	TraceFired
+	// TraceTimedOut is reported when the listener expires
+	TraceTimedOut
+	// TraceEnded is reported when the listener ends any other way; TraceEvent.Err says why
+	TraceEnded
+)
+
+// TraceEvent is one step of a wait traced with WaitTraced
+type TraceEvent struct {
+	Kind TraceKind
+	Time time.Time
+	Err  error
+}
+
+// traceLog is a trace channel that never blocks its writer, the run goroutine: when the buffer
+// is full the oldest step is dropped to make room
+type traceLog chan TraceEvent
+
+func (t traceLog) add(kind TraceKind, err error, at time.Time) {
+	step := TraceEvent{Kind: kind, Time: at, Err: err}
+	for {
+		select {
+		case t <- step:
+			return
+		default:
+		}
+		select {
+		case <-t:
+		default:
+		}
+	}
+}
+
+// WaitTraced is Wait, and also returns a channel reporting each step of the listener's life,
+// which is closed after its final step; if the trace is not read, older steps are dropped
+func (l *Loop) WaitTraced(key string) (<-chan Event, <-chan TraceEvent) {
+	trace := make(traceLog, 16)
+	add := func(kind TraceKind, err error) { trace.add(kind, err, l.now()) }
+	out := l.waitHooked(key, 0, func(e Event) {
+		switch e.Error {
+		case nil:
+			add(TraceFired, nil)
+		case ErrTimedOut:
+			add(TraceTimedOut, nil)
+		default:
+			add(TraceEnded, e.Error)
+		}
+		close(trace)
+	}, func(lis *listener) {
+		lis.Trace = add
+	})
+	return out, trace
+}
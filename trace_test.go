@@ -0,0 +1,83 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// steps reads trace until it closes
+func steps(t *testing.T, trace <-chan waitloop.TraceEvent) []waitloop.TraceEvent {
+	t.Helper()
+	var all []waitloop.TraceEvent
+	for {
+		select {
+		case step, ok := <-trace:
+			if !ok {
+				return all
+			}
+			all = append(all, step)
+		case <-time.After(patience):
+			t.Fatal("timed out waiting for the trace to close")
+		}
+	}
+}
+
+// checkSteps compares a trace with the kinds and fake clock times wanted
+func checkSteps(t *testing.T, got []waitloop.TraceEvent, start time.Time, kinds []waitloop.TraceKind, offsets []time.Duration) {
+	t.Helper()
+	if len(got) != len(kinds) {
+		t.Fatalf("got %d steps %+v, want %v", len(got), got, kinds)
+	}
+	for i, step := range got {
+		if step.Kind != kinds[i] || !step.Time.Equal(start.Add(offsets[i])) {
+			t.Fatalf("step %d is %+v, want kind %v at %v", i, step, kinds[i], offsets[i])
+		}
+	}
+}
+
+func TestWaitTracedFired(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	start := clock.Now()
+	ch, trace := l.WaitTraced("key")
+	waitListeners(t, l, 1)
+	advance(t, l, clock, time.Second)
+	advance(t, l, clock, time.Second)
+	send(t, l, waitloop.Event{Key: "key"})
+	recv(t, ch)
+
+	checkSteps(t, steps(t, trace), start,
+		[]waitloop.TraceKind{waitloop.TraceRegistered, waitloop.TraceCleanupSkipped, waitloop.TraceCleanupSkipped, waitloop.TraceFired},
+		[]time.Duration{0, time.Second, 2 * time.Second, 2 * time.Second})
+}
+
+func TestWaitTracedTimedOut(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: 2 * time.Second})
+	start := clock.Now()
+	ch, trace := l.WaitTraced("key")
+	waitListeners(t, l, 1)
+	for i := 0; i < 3; i++ {
+		advance(t, l, clock, time.Second)
+	}
+	recv(t, ch)
+
+	// At exactly its TTL the listener has not expired yet
+	checkSteps(t, steps(t, trace), start,
+		[]waitloop.TraceKind{waitloop.TraceRegistered, waitloop.TraceCleanupSkipped, waitloop.TraceCleanupSkipped, waitloop.TraceTimedOut},
+		[]time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second})
+}
+
+func TestWaitTracedTerminated(t *testing.T) {
+	l := newLoop(t, nil)
+	ch, trace := l.WaitTraced("key")
+	waitListeners(t, l, 1)
+	l.Terminate()
+	recv(t, ch)
+
+	got := steps(t, trace)
+	if len(got) != 2 || got[0].Kind != waitloop.TraceRegistered || got[1].Kind != waitloop.TraceEnded ||
+		got[1].Err != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %+v, want registered then ended by termination", got)
+	}
+}
@@ -0,0 +1,94 @@
+package waitloop
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// ttlOverrides holds the TTLs set with SetKeyTTL and SetPrefixTTL
+type ttlOverrides struct {
+	mu       sync.RWMutex
+	keys     map[string]time.Duration
+	prefixes map[string]time.Duration
+}
+
+// SetKeyTTL sets the TTL for Waits on key, when the caller doesn't give one explicitly; it takes
+// precedence over prefix TTLs, and a ttl of zero removes it
+func (l *Loop) SetKeyTTL(key string, ttl time.Duration) {
+	l.ttls.mu.Lock()
+	defer l.ttls.mu.Unlock()
+	l.ttls.keys = setTTL(l.ttls.keys, key, ttl)
+}
+
+// SetPrefixTTL sets the TTL for Waits on keys starting with prefix, when the caller doesn't give
+// one explicitly; the longest matching prefix wins, and a ttl of zero removes the prefix's TTL
+func (l *Loop) SetPrefixTTL(prefix string, ttl time.Duration) {
+	l.ttls.mu.Lock()
+	defer l.ttls.mu.Unlock()
+	l.ttls.prefixes = setTTL(l.ttls.prefixes, prefix, ttl)
+}
+
+func setTTL(ttls map[string]time.Duration, name string, ttl time.Duration) map[string]time.Duration {
+	if ttl <= 0 {
+		delete(ttls, name)
+		return ttls
+	}
+	if ttls == nil {
+		ttls = map[string]time.Duration{}
+	}
+	ttls[name] = ttl
+	return ttls
+}
+
+// ttlFor resolves the TTL for a listener on key. The first of these that is set wins:
+//  1. explicit, the TTL the caller passed (WaitTTL and the like)
+//  2. the key's own TTL, from SetKeyTTL
+//  3. the longest matching prefix's TTL, from SetPrefixTTL
+//  4. LoopOptions.TTLFunc, if it returns a positive TTL
+//  5. LoopOptions.TTL, the loop default
+//
+// The result is then clamped to LoopOptions.MaxTTL, if that is set
+func (l *Loop) ttlFor(key string, explicit time.Duration) time.Duration {
+	ttl := explicit
+	if ttl <= 0 {
+		ttl = l.configuredTTL(key)
+	}
+	if ttl <= 0 {
+		ttl = l.defaultTTL
+	}
+	if l.maxTTL > 0 && ttl > l.maxTTL {
+		ttl = l.maxTTL
+	}
+	return ttl
+}
+
+// configuredTTL is the TTL chosen for key by SetKeyTTL, SetPrefixTTL or LoopOptions.TTLFunc, or
+// zero if none of them has one; LoopOptions.RequireExplicitTTL accepts it in place of the caller's
+func (l *Loop) configuredTTL(key string) time.Duration {
+	if ttl := l.overrideTTL(key); ttl > 0 {
+		return ttl
+	}
+	if l.ttlFunc != nil {
+		return l.ttlFunc(key)
+	}
+	return 0
+}
+
+// overrideTTL is the TTL set for key with SetKeyTTL or SetPrefixTTL, or zero if there is none
+func (l *Loop) overrideTTL(key string) time.Duration {
+	l.ttls.mu.RLock()
+	defer l.ttls.mu.RUnlock()
+
+	if ttl, ok := l.ttls.keys[key]; ok {
+		return ttl
+	}
+	var ttl time.Duration
+	longest := -1
+	for prefix, prefixTTL := range l.ttls.prefixes {
+		if len(prefix) > longest && strings.HasPrefix(key, prefix) {
+			ttl, longest = prefixTTL, len(prefix)
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,298 @@
+package waitloop_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestRequireExplicitTTL(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{RequireExplicitTTL: true})
+	if e := recv(t, l.Wait("key")); e.Error != waitloop.ErrTTLRequired {
+		t.Fatalf("got %v, want ErrTTLRequired", e.Error)
+	}
+	if e := recv(t, l.WaitTTL("key", 0)); e.Error != waitloop.ErrTTLRequired {
+		t.Fatalf("WaitTTL without a ttl: got %v, want ErrTTLRequired", e.Error)
+	}
+
+	ch := l.WaitTTL("key", time.Minute)
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	if e := recv(t, ch); e.Error != nil || e.Data != 1 {
+		t.Fatalf("got %+v, want the event", e)
+	}
+}
+
+func TestRequireExplicitTTLCoversEveryDefaultTTLWait(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{RequireExplicitTTL: true})
+	waits := map[string]func() <-chan waitloop.Event{
+		"WaitPrefix":         func() <-chan waitloop.Event { return l.WaitPrefix("key") },
+		"WaitSized":          func() <-chan waitloop.Event { return l.WaitSized("key", 1) },
+		"WaitFilter":         func() <-chan waitloop.Event { return l.WaitFilter("key", nil) },
+		"WaitN":              func() <-chan waitloop.Event { return l.WaitN("key", 2) },
+		"WaitWork":           func() <-chan waitloop.Event { return l.WaitWork("key", 0) },
+		"WaitPriority":       func() <-chan waitloop.Event { return l.WaitPriority("key", 0) },
+		"WaitWithCleanup":    func() <-chan waitloop.Event { return l.WaitWithCleanup("key", func(waitloop.Event) {}) },
+		"WaitWithRemoveHook": func() <-chan waitloop.Event { return l.WaitWithRemoveHook("key", func(error) {}) },
+		"WaitUnless":         func() <-chan waitloop.Event { return l.WaitUnless("key", "cancel") },
+		"WaitAny":            func() <-chan waitloop.Event { return l.WaitAny("a", "b") },
+		"WaitAll":            func() <-chan waitloop.Event { return l.WaitAll("a", "b") },
+		"WaitResumable":      func() <-chan waitloop.Event { return l.WaitResumable("key", "token") },
+		"WaitContext":        func() <-chan waitloop.Event { return l.WaitContext(context.Background(), "key") },
+		"WaitKey":            func() <-chan waitloop.Event { return l.WaitKey(waitloop.CompositeKey{"a", 1}) },
+		"WaitWithID": func() <-chan waitloop.Event {
+			ch, _ := l.WaitWithID("key")
+			return ch
+		},
+		"WaitTraced": func() <-chan waitloop.Event {
+			ch, _ := l.WaitTraced("key")
+			return ch
+		},
+		"WaitCancelable": func() <-chan waitloop.Event {
+			ch, _ := l.WaitCancelable("key")
+			return ch
+		},
+		"WaitSubscription": func() <-chan waitloop.Event { return l.WaitSubscription("key").C() },
+		"WaitWithTimeoutAction": func() <-chan waitloop.Event {
+			return l.WaitWithTimeoutAction("key", 0, func() {})
+		},
+	}
+	for name, wait := range waits {
+		if e := recv(t, wait()); e.Error != waitloop.ErrTTLRequired {
+			t.Errorf("%s: got %v, want ErrTTLRequired", name, e.Error)
+		}
+	}
+	quorum := <-l.WaitQuorum([]string{"a", "b"}, 1)
+	if len(quorum) != 1 || quorum[0].Error != waitloop.ErrTTLRequired {
+		t.Errorf("WaitQuorum: got %+v, want ErrTTLRequired", quorum)
+	}
+	if n := l.ListenerCount(); n != 0 {
+		t.Fatalf("%d listeners registered", n)
+	}
+}
+
+func TestRequireExplicitTTLAllowsSubscriptions(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{RequireExplicitTTL: true})
+	got := make(chan waitloop.Event, 1)
+	defer l.Subscribe("key", func(e waitloop.Event) { got <- e })()
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key"})
+	recv(t, got)
+}
+
+// ttlOf registers a wait on key and reports the TTL it was given
+func ttlOf(t *testing.T, l *waitloop.Loop, clock interface{ Now() time.Time }, key string) time.Duration {
+	t.Helper()
+	_, id := l.WaitWithID(key)
+	var status waitloop.ListenerStatus
+	waitUntil(t, "the listener to register", func() bool {
+		s, ok := l.Inspect(id)
+		status = s
+		return ok
+	})
+	return status.Expiration.Sub(clock.Now())
+}
+
+func TestSetPrefixTTLLongestMatchWins(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	l.SetPrefixTTL("jobs/", 10*time.Minute)
+	l.SetPrefixTTL("jobs/batch/", time.Hour)
+	l.SetPrefixTTL("jobs/batch/nightly/", 0) // zero without a TTL to remove changes nothing
+
+	tests := []struct {
+		key  string
+		want time.Duration
+	}{
+		{"jobs/1", 10 * time.Minute},
+		{"jobs/batch/1", time.Hour},
+		{"jobs/batch/nightly/1", time.Hour},
+		{"jobs", time.Minute},
+		{"other/1", time.Minute},
+	}
+	for _, tt := range tests {
+		if got := ttlOf(t, l, clock, tt.key); got != tt.want {
+			t.Errorf("%s got TTL %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSetPrefixTTLOverrides(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	l.SetPrefixTTL("jobs/", 10*time.Minute)
+	l.SetKeyTTL("jobs/special", 2*time.Minute)
+
+	if got := ttlOf(t, l, clock, "jobs/special"); got != 2*time.Minute {
+		t.Fatalf("key TTL gave %v, want it to beat the prefix", got)
+	}
+	l.SetPrefixTTL("jobs/", 0)
+	if got := ttlOf(t, l, clock, "jobs/1"); got != time.Minute {
+		t.Fatalf("removed prefix TTL still gave %v, want the default", got)
+	}
+}
+
+func TestSetPrefixTTLExpiresListeners(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Hour})
+	l.SetPrefixTTL("fast/", time.Minute)
+	fast := l.Wait("fast/1")
+	slow := l.Wait("slow/1")
+	explicit := l.WaitTTL("fast/2", 5*time.Minute)
+	waitListeners(t, l, 3)
+
+	advance(t, l, clock, 2*time.Minute)
+	if e := recv(t, fast); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+	noRecv(t, slow)
+	// An explicit TTL beats the prefix
+	noRecv(t, explicit)
+	advance(t, l, clock, 5*time.Minute)
+	recv(t, explicit)
+}
+
+func TestWaitTTLOverridesTheDefault(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Hour})
+	short := l.WaitTTL("key", 200*time.Millisecond)
+	long := l.Wait("key")
+	longer := l.WaitTTL("key", 2*time.Hour)
+	waitListeners(t, l, 3)
+
+	advance(t, l, clock, time.Second)
+	if e := recv(t, short); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+	noRecv(t, long)
+	noRecv(t, longer)
+
+	advance(t, l, clock, time.Hour)
+	if e := recv(t, long); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+	noRecv(t, longer)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	if e := recv(t, longer); e.Data != 1 {
+		t.Fatalf("got %+v, want the event", e)
+	}
+}
+
+func TestWaitTTLNonPositiveUsesTheDefault(t *testing.T) {
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+		ch := l.WaitTTL("key", ttl)
+		waitListeners(t, l, 1)
+		advance(t, l, clock, 30*time.Second)
+		noRecv(t, ch)
+		advance(t, l, clock, time.Minute)
+		if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+			t.Fatalf("ttl %v: got %v, want ErrTimedOut", ttl, e.Error)
+		}
+	}
+}
+
+func TestTTLPrecedence(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{
+		TTL:    time.Minute,
+		MaxTTL: 3 * time.Hour,
+		TTLFunc: func(key string) time.Duration {
+			if strings.HasPrefix(key, "func/") || strings.HasPrefix(key, "prefix/") {
+				return 4 * time.Minute
+			}
+			if strings.HasPrefix(key, "long/") {
+				return 5 * time.Hour
+			}
+			return 0
+		},
+	})
+	l.SetKeyTTL("prefix/key", 2*time.Minute)
+	l.SetPrefixTTL("prefix/", 3*time.Minute)
+
+	tests := []struct {
+		key  string
+		want time.Duration
+	}{
+		{"prefix/key", 2 * time.Minute},   // the key's own TTL beats its prefix
+		{"prefix/other", 3 * time.Minute}, // the prefix beats TTLFunc
+		{"func/key", 4 * time.Minute},     // TTLFunc beats the default
+		{"default", time.Minute},          // TTLFunc returned zero
+		{"long/key", 3 * time.Hour},       // clamped to MaxTTL
+	}
+	for _, test := range tests {
+		if got := ttlOf(t, l, clock, test.key); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.key, got, test.want)
+		}
+	}
+}
+
+func TestTTLPrecedenceExplicitWins(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute, MaxTTL: time.Hour})
+	l.SetKeyTTL("key", 10*time.Minute)
+	short := l.WaitTTL("key", 5*time.Minute)
+	clamped := l.WaitTTL("key", 2*time.Hour)
+	keyed := l.Wait("key")
+	waitListeners(t, l, 3)
+
+	advance(t, l, clock, 6*time.Minute)
+	if e := recv(t, short); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want the explicit TTL to beat the key's", e.Error)
+	}
+	noRecv(t, keyed)
+	advance(t, l, clock, 5*time.Minute)
+	recv(t, keyed)
+	noRecv(t, clamped)
+	advance(t, l, clock, time.Hour)
+	if e := recv(t, clamped); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want the explicit TTL clamped to MaxTTL", e.Error)
+	}
+}
+
+func TestRequireExplicitTTLAcceptsConfiguredTTLs(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{
+		RequireExplicitTTL: true,
+		TTLFunc: func(key string) time.Duration {
+			if strings.HasPrefix(key, "func/") {
+				return time.Minute
+			}
+			return 0
+		},
+	})
+	l.SetKeyTTL("keyed", time.Minute)
+	l.SetPrefixTTL("prefix/", time.Minute)
+
+	for _, key := range []string{"keyed", "prefix/1", "func/1"} {
+		waits := map[string]func() <-chan waitloop.Event{
+			"Wait":        func() <-chan waitloop.Event { return l.Wait(key) },
+			"WaitN":       func() <-chan waitloop.Event { return l.WaitN(key, 1) },
+			"WaitFilter":  func() <-chan waitloop.Event { return l.WaitFilter(key, nil) },
+			"WaitWork":    func() <-chan waitloop.Event { return l.WaitWork(key, 0) },
+			"WaitAny":     func() <-chan waitloop.Event { return l.WaitAny(key) },
+			"WaitAll":     func() <-chan waitloop.Event { return l.WaitAll(key) },
+			"WaitContext": func() <-chan waitloop.Event { return l.WaitContext(context.Background(), key) },
+			"WaitResumable": func() <-chan waitloop.Event {
+				return l.WaitResumable(key, "token")
+			},
+		}
+		for name, wait := range waits {
+			ch := wait()
+			waitListeners(t, l, 1)
+			send(t, l, waitloop.Event{Key: key, Data: name})
+			if e := recv(t, ch); e.Error != nil {
+				t.Errorf("%s on %s: got %v, want the event", name, key, e.Error)
+			}
+			waitListeners(t, l, 0)
+		}
+	}
+}
+
+func TestRequireExplicitTTLAcceptsAContextDeadline(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{RequireExplicitTTL: true})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	ch := l.WaitContext(ctx, "key")
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	if e := recv(t, ch); e.Error != nil || e.Data != 1 {
+		t.Fatalf("got %+v, want the event", e)
+	}
+}
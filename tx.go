@@ -0,0 +1,49 @@
+package waitloop
+
+import "sync/atomic"
+
+// Tx queues events for Transaction
+type Tx struct {
+	events  []Event
+	aborted bool
+}
+
+// Send queues an event to be sent when the transaction commits
+func (tx *Tx) Send(e Event) {
+	tx.events = append(tx.events, e)
+}
+
+// Abort discards the transaction; nothing it queued, before or after, is sent
+func (tx *Tx) Abort() {
+	tx.aborted = true
+}
+
+// Transaction runs fn, then hands every event it queued on tx to the loop as one batch that is
+// processed without other work interleaved; if fn aborts or panics, nothing is sent, and if
+// LoopOptions.Validate rejects any of the events, none are sent and its error is returned; on a
+// terminated loop nothing is sent and it returns ErrLoopTerminated
+func (l *Loop) Transaction(fn func(tx *Tx)) error {
+	tx := &Tx{}
+	fn(tx)
+	if tx.aborted || len(tx.events) == 0 {
+		return nil
+	}
+	for _, e := range tx.events {
+		if err := l.check(e); err != nil {
+			return err
+		}
+	}
+	sent := l.now()
+	ok := l.exec(func() {
+		atomic.AddUint64(&l.counters.sent, uint64(len(tx.events)))
+		for _, e := range tx.events {
+			e.sent = sent
+			l.dispatch(sentEvent{event: e})
+		}
+	})
+	if !ok {
+		atomic.AddUint64(&l.counters.dropped, uint64(len(tx.events)))
+		return ErrLoopTerminated
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package waitloop_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestTransactionCommits(t *testing.T) {
+	l := newLoop(t, nil)
+	a, b := l.Wait("a"), l.WaitN("b", 2)
+	waitListeners(t, l, 2)
+
+	err := l.Transaction(func(tx *waitloop.Tx) {
+		tx.Send(waitloop.Event{Key: "a", Data: 1})
+		tx.Send(waitloop.Event{Key: "b", Data: 2})
+		tx.Send(waitloop.Event{Key: "b", Data: 3})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := recv(t, a); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+	for _, want := range []int{2, 3} {
+		if e := recv(t, b); e.Data != want {
+			t.Fatalf("got %v, want %d", e.Data, want)
+		}
+	}
+}
+
+func TestTransactionAborts(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+
+	err := l.Transaction(func(tx *waitloop.Tx) {
+		tx.Send(waitloop.Event{Key: "key"})
+		tx.Abort()
+		tx.Send(waitloop.Event{Key: "key"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Ping(patience)
+	noRecv(t, ch)
+}
+
+func TestTransactionPanics(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic did not reach the caller")
+			}
+		}()
+		l.Transaction(func(tx *waitloop.Tx) {
+			tx.Send(waitloop.Event{Key: "key"})
+			panic("oops")
+		})
+	}()
+	l.Ping(patience)
+	noRecv(t, ch)
+}
+
+func TestTransactionRejected(t *testing.T) {
+	invalid := errors.New("invalid")
+	l := newLoop(t, &waitloop.LoopOptions{Validate: func(e waitloop.Event) error {
+		if e.Data == nil {
+			return invalid
+		}
+		return nil
+	}})
+	ch := l.Wait("key")
+	waitListeners(t, l, 1)
+
+	err := l.Transaction(func(tx *waitloop.Tx) {
+		tx.Send(waitloop.Event{Key: "key", Data: 1})
+		tx.Send(waitloop.Event{Key: "key"})
+	})
+	if err != invalid {
+		t.Fatalf("got %v, want the validation error", err)
+	}
+	l.Ping(patience)
+	noRecv(t, ch)
+}
+
+func TestTransactionTerminated(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Terminate()
+	stopped(t, l)
+	err := l.Transaction(func(tx *waitloop.Tx) { tx.Send(waitloop.Event{Key: "key"}) })
+	if err != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", err)
+	}
+}
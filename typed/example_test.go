@@ -0,0 +1,41 @@
+package typed_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+	"github.com/fsufitch/waitloop/typed"
+)
+
+type Order struct {
+	ID    string
+	Items int
+}
+
+func Example() {
+	// StickyTTL holds the event for the listener even if Send gets to the loop first
+	loop := typed.NewCustom[Order](&waitloop.LoopOptions{StickyTTL: time.Minute})
+	defer loop.Terminate()
+
+	shipped := loop.Wait("order.shipped")
+	loop.Send(typed.Event[Order]{Key: "order.shipped", Data: Order{ID: "42", Items: 3}})
+
+	e := <-shipped
+	if e.Error != nil {
+		fmt.Println("error:", e.Error)
+		return
+	}
+	// Data is an Order, no type assertion needed
+	fmt.Println(e.Data.ID, e.Data.Items)
+	// Output: 42 3
+}
+
+func ExampleLoop_WaitTTL() {
+	loop := typed.NewCustom[Order](&waitloop.LoopOptions{CleanupInterval: time.Millisecond})
+	defer loop.Terminate()
+
+	e := <-loop.WaitTTL("order.lost", time.Millisecond)
+	fmt.Println(e.Error == waitloop.ErrTimedOut, e.Data.ID == "")
+	// Output: true true
+}
@@ -0,0 +1,89 @@
+// Package typed wraps waitloop.Loop so that event payloads are statically typed
+//
+//	type Order struct{ ID string }
+//
+//	loop := typed.New[Order]()
+//	done := loop.Wait("order.shipped")
+//	loop.Send(typed.Event[Order]{Key: "order.shipped", Data: Order{ID: "42"}})
+//	fmt.Println((<-done).Data.ID)
+package typed
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+// ErrWrongType is sent in the Event if the underlying loop delivered data that is not a T, which
+// can only happen if something sent on it directly through Untyped
+var ErrWrongType = errors.New("event data has the wrong type")
+
+// Event is waitloop.Event with a Data of type T
+type Event[T any] struct {
+	Key   string
+	Data  T
+	Error error
+}
+
+// Loop is a waitloop.Loop whose events all carry a T; Initialize it with New() or NewCustom()
+type Loop[T any] struct {
+	loop *waitloop.Loop
+}
+
+// New creates a typed loop with the default waitloop options
+func New[T any]() *Loop[T] {
+	return &Loop[T]{loop: waitloop.New()}
+}
+
+// NewCustom creates a typed loop with the given waitloop options
+func NewCustom[T any](options *waitloop.LoopOptions) *Loop[T] {
+	return &Loop[T]{loop: waitloop.NewCustom(options)}
+}
+
+// Untyped returns the underlying loop, for its other methods (Terminate, Shutdown, stats...)
+func (l *Loop[T]) Untyped() *waitloop.Loop {
+	return l.loop
+}
+
+// Wait registers a new listener, and returns a channel on which the Event will arrive
+func (l *Loop[T]) Wait(key string) <-chan Event[T] {
+	return convert[T](l.loop.Wait(key))
+}
+
+// WaitTTL is Wait with the given TTL, as waitloop.Loop.WaitTTL
+func (l *Loop[T]) WaitTTL(key string, ttl time.Duration) <-chan Event[T] {
+	return convert[T](l.loop.WaitTTL(key, ttl))
+}
+
+// Send receives an Event and triggers any listeners with its key, as waitloop.Loop.Send
+func (l *Loop[T]) Send(e Event[T]) error {
+	return l.loop.Send(waitloop.Event{Key: e.Key, Data: e.Data, Error: e.Error})
+}
+
+// Terminate stops the event loop and cancels any listeners
+func (l *Loop[T]) Terminate() {
+	l.loop.Terminate()
+}
+
+// convert relays the single event on in as an Event[T]
+func convert[T any](in <-chan waitloop.Event) <-chan Event[T] {
+	out := make(chan Event[T], 1)
+	go func() {
+		defer close(out)
+		e, ok := <-in
+		if !ok {
+			return
+		}
+		typed := Event[T]{Key: e.Key, Error: e.Error}
+		if e.Data != nil {
+			data, ok := e.Data.(T)
+			if !ok && typed.Error == nil {
+				typed.Error = ErrWrongType
+			}
+			typed.Data = data
+		}
+		out <- typed
+	}()
+	return out
+}
@@ -0,0 +1,46 @@
+package waitloop
+
+// WaitUnless waits for key like Wait, unless cancelKey fires first, in which case the wait is
+// cancelled with ErrCanceled (see LoopOptions.CloseSilentlyOnCancel)
+func (l *Loop) WaitUnless(key, cancelKey string) <-chan Event {
+	out := make(chan Event, 1)
+	main := l.waitListener(key, 0)
+	guard := l.waitListener(cancelKey, 0)
+	main.Group, guard.Group = true, true
+
+	// Both handlers run on the run goroutine, so done needs no locking
+	done := false
+	main.Handler = func(e Event) {
+		if done {
+			return
+		}
+		done = true
+		l.removeListener(guard.Key, guard.ID)
+		l.send(out, e)
+	}
+	guard.Handler = func(e Event) {
+		if done || e.Error != nil {
+			// A failed guard leaves the outcome to the main listener, which shares its TTL
+			return
+		}
+		done = true
+		l.removeListener(main.Key, main.ID)
+		l.send(out, Event{Key: key, Error: ErrCanceled})
+	}
+
+	if err := l.admit(main, guard); err != nil {
+		l.send(out, Event{Key: key, Error: err})
+		return out
+	}
+	ok := l.exec(func() {
+		l.registerListener(main)
+		// A sticky event may already have settled the wait, and then the guard is not needed
+		if !done {
+			l.registerListener(guard)
+		}
+	})
+	if !ok {
+		l.send(out, Event{Key: key, Error: ErrLoopTerminated})
+	}
+	return out
+}
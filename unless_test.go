@@ -0,0 +1,60 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestWaitUnlessKeyFirst(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitUnless("job", "cancel")
+	waitListeners(t, l, 2)
+
+	send(t, l, waitloop.Event{Key: "job", Data: 1})
+	if e := recv(t, ch); e.Error != nil || e.Data != 1 {
+		t.Fatalf("got %+v, want the job event", e)
+	}
+	// The guard goes with it
+	waitListeners(t, l, 0)
+	if n := send(t, l, waitloop.Event{Key: "cancel"}); n != 0 {
+		t.Fatalf("cancel reached %d listeners, want 0", n)
+	}
+}
+
+func TestWaitUnlessCancelKeyFirst(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitUnless("job", "cancel")
+	waitListeners(t, l, 2)
+
+	send(t, l, waitloop.Event{Key: "cancel"})
+	if e := recv(t, ch); e.Error != waitloop.ErrCanceled || e.Key != "job" {
+		t.Fatalf("got %+v, want ErrCanceled on job", e)
+	}
+	waitListeners(t, l, 0)
+	if n := send(t, l, waitloop.Event{Key: "job"}); n != 0 {
+		t.Fatalf("job reached %d listeners, want 0", n)
+	}
+}
+
+func TestWaitUnlessBothTimeOut(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	ch := l.WaitUnless("job", "cancel")
+	waitListeners(t, l, 2)
+
+	advance(t, l, clock, 2*time.Minute)
+	if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+	closed(t, ch)
+	waitListeners(t, l, 0)
+}
+
+func TestWaitUnlessCountsTwoRegistrations(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{MaxRegistrationsPerSecond: 2})
+	l.WaitUnless("job", "cancel")
+	if e := recv(t, l.Wait("other")); e.Error != waitloop.ErrRateLimited {
+		t.Fatalf("got %v, want ErrRateLimited", e.Error)
+	}
+}
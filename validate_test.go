@@ -0,0 +1,85 @@
+package waitloop_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fsufitch/waitloop"
+)
+
+var errForbidden = errors.New("forbidden key")
+
+// newValidatedLoop creates a loop that rejects events on forbidden/ keys, or with "forbidden" data
+func newValidatedLoop(t *testing.T) *waitloop.Loop {
+	return newLoop(t, &waitloop.LoopOptions{Validate: func(e waitloop.Event) error {
+		if strings.HasPrefix(e.Key, "forbidden/") || e.Data == "forbidden" {
+			return errForbidden
+		}
+		return nil
+	}})
+}
+
+func TestValidateRejectsEventsOnEverySendPath(t *testing.T) {
+	const key = "forbidden/1"
+	paths := []struct {
+		name string
+		send func(l *waitloop.Loop) error
+	}{
+		{"Send", func(l *waitloop.Loop) error { return l.Send(waitloop.Event{Key: key}) }},
+		{"SendWhenReady", func(l *waitloop.Loop) error { return l.SendWhenReady(context.Background(), key, nil) }},
+		{"Transaction", func(l *waitloop.Loop) error {
+			return l.Transaction(func(tx *waitloop.Tx) {
+				tx.Send(waitloop.Event{Key: "allowed"})
+				tx.Send(waitloop.Event{Key: key})
+			})
+		}},
+		{"TrySend", func(l *waitloop.Loop) error {
+			if l.TrySend(waitloop.Event{Key: key}) {
+				return nil
+			}
+			return errForbidden
+		}},
+		{"SendWhere", func(l *waitloop.Loop) error {
+			if l.SendWhere(key, nil, func(waitloop.ListenerInfo) bool { return true }) > 0 {
+				return nil
+			}
+			return errForbidden
+		}},
+		{"Broadcast", func(l *waitloop.Loop) error { return l.Broadcast("forbidden") }},
+	}
+	for _, p := range paths {
+		t.Run(p.name, func(t *testing.T) {
+			l := newValidatedLoop(t)
+			ch := l.Wait(key)
+			allowed := l.Wait("allowed")
+			waitListeners(t, l, 2)
+
+			if err := p.send(l); err != errForbidden {
+				t.Fatalf("got %v, want the validator's error", err)
+			}
+			l.Ping(patience)
+			noRecv(t, ch)
+			noRecv(t, allowed)
+			if n := l.SentEvents(); n != 0 {
+				t.Fatalf("counted %d sent events, want none", n)
+			}
+		})
+	}
+}
+
+func TestValidateAcceptsOtherEvents(t *testing.T) {
+	l := newValidatedLoop(t)
+	ch := l.Wait("allowed/1")
+	waitListeners(t, l, 1)
+	if err := l.Send(waitloop.Event{Key: "allowed/1", Data: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if e := recv(t, ch); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+	if n := l.SentEvents(); n != 1 {
+		t.Fatalf("counted %d sent events, want 1", n)
+	}
+}
@@ -1,7 +1,14 @@
 package waitloop
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,10 +18,65 @@ var ErrLoopTerminated = errors.New("loop was terminated")
 // ErrTimedOut is sent in the Event to close things out in the event that the listener's TTL was met
 var ErrTimedOut = errors.New("wait timed out")
 
+// ErrCanceled is the cause recorded when a listener is cancelled before its event arrives
+var ErrCanceled = errors.New("wait canceled")
+
+// ErrTooManyListeners is sent in the Event if the key already had LoopOptions.MaxListenersPerKey listeners
+var ErrTooManyListeners = errors.New("too many listeners for key")
+
+// ErrMemoryLimit is sent in the Event if registering the listener would exceed LoopOptions.MaxListenerBytes
+var ErrMemoryLimit = errors.New("listener memory limit reached")
+
+// ErrLoopRunning is returned by Reset if the loop has not stopped
+var ErrLoopRunning = errors.New("loop is still running")
+
+// ErrTTLRequired is sent in the Event if a wait without a TTL is made under LoopOptions.RequireExplicitTTL
+var ErrTTLRequired = errors.New("explicit TTL required")
+
 type listener struct {
+	ID         uint64
 	Key        string
 	Channel    chan Event
+	Registered time.Time
 	Expiration time.Time
+	Priority   int // higher priorities are served first by workers and termination
+
+	// Worker listeners share each event: it goes to only one of them, by Priority
+	Worker bool
+
+	// Tracked listeners can be looked up with Inspect for a while after they finish
+	Tracked bool
+
+	// Handler, if set, receives the listener's event on the run goroutine instead of Channel
+	Handler func(Event)
+
+	// Persistent listeners stay registered after each event and never expire; Handler receives
+	// every event, and End the error that finally removes the listener
+	Persistent bool
+	End        func(error)
+
+	// Trace, if set, is told about each step of the listener's life (see WaitTraced)
+	Trace func(TraceKind, error)
+
+	// Prefix listeners live in prefixMap, and match every key that starts with their Key
+	Prefix bool
+
+	// Bytes is the caller's estimate of what the wait holds on to (see WaitSized)
+	Bytes int
+
+	// Group listeners are one part of a wait on several keys, such as WaitAny or WaitUnless
+	Group bool
+
+	// Filter, if set, picks the events the listener takes; it is passed over for the others (see
+	// WaitFilter)
+	Filter func(Event) bool
+
+	// Remaining, if above one, is how many more events the listener takes before it ends; Handler
+	// receives each of them (see WaitN)
+	Remaining int
+
+	// DefaultTTL listeners fell back to LoopOptions.TTL (see LoopOptions.RequireExplicitTTL)
+	DefaultTTL bool
 }
 
 // Event is a container for data that may trigger listeners
@@ -22,32 +84,218 @@ type Event struct {
 	Key   string
 	Data  interface{}
 	Error error
+
+	// Seq is set by the loop when the event is processed; it counts up by one per event on each key,
+	// starting again from one on a key that has gone a whole TTL with no events and no listeners
+	Seq uint64
+
+	// Priority orders queued events: higher priorities are processed first (see LoopOptions.PriorityAging)
+	Priority int
+
+	// ID identifies the event so that others can name it as their CausedBy; the loop assigns one
+	// when the event is processed, unless the sender set it
+	ID string
+
+	// CausedBy is the ID of the event this one was sent in response to, if any (see Reply)
+	CausedBy string
+
+	// Expiration, if set, is when the event goes stale: if the loop only gets to it afterwards,
+	// because it sat behind a backlog or on a paused key, it is dropped instead of delivered
+	Expiration time.Time
+
+	// via records the loops a mirrored event has already passed through
+	via *mirrorHop
+
+	// sent is when Send accepted the event
+	sent time.Time
 }
 
 // Loop is the main event loop; Initialize it with New() or NewCustom()
 type Loop struct {
-	listenerMap       map[string][]listener
-	terminated        bool
-	terminateChan     chan struct{}
-	incomingEvents    chan Event
-	incomingListeners chan listener
-	defaultTTL        time.Duration
-	cleanupTicker     *time.Ticker
+	counters           counters
+	nextID             uint64
+	started            int32
+	terminated         int32
+	listenerMap        map[string][]listener
+	prefixMap          map[string][]listener
+	waitStats          map[string]*waitSummary
+	idleWatchers       map[string][]chan struct{}
+	sequences          map[string]sequence
+	paused             map[string][]sentEvent
+	mirrors            map[uint64]*mirror
+	inflight           tracker
+	sends              tracker // channel deliveries, which never block, unlike hooks
+	causes             causes
+	terminateChan      chan struct{}
+	terminateOnce      sync.Once
+	incomingEvents     chan sentEvent
+	eventSlots         chan struct{} // one per event in incomingEvents or the queue
+	incomingListeners  chan listener
+	commands           chan func()
+	done               chan struct{}
+	defaultTTL         time.Duration
+	clock              Clock
+	cleanupTicker      Ticker
+	registrations      *tokenBucket
+	queueRateLimited   bool
+	maxListenersPerKey int
+	closeOnCancel      bool
+	directDelivery     bool
+	ordered            *sequencer
+	coalesceWindow     time.Duration
+	coalesceTimer      Timer
+	coalescing         map[string]*coalesced
+	panicPolicy        PanicPolicy
+	lifetime           Timer
+	cleanupPaused      bool
+	notified           map[uint64]bool
+	cleanupWatchers    []chan CleanupResult
+	queue              eventQueue
+	finished           map[uint64]finishedListener
+	pool               *workerPool
+	ttls               ttlOverrides
+	idleTimeout        time.Duration
+	idleTimer          Timer
+	lastActive         time.Time
+	validate           func(Event) error
+	requireTTL         bool
+	maxListenerBytes   int
+	listenerBytes      int
+	onFire             func(string, int)
+	logger             func(string, string, ...interface{})
+	stickyTTL          time.Duration
+	sticky             map[string]stickyEvent
+	readySends         map[string][]*readySend
+	resumables         map[resumeToken]*resumable
+	ttlFunc            func(string) time.Duration
+	maxTTL             time.Duration
+	options            LoopOptions
+	resetMu            sync.Mutex
+
+	// terminatedListeners is how many listeners terminate notified; it is read after done closes
+	terminatedListeners int
 }
 
 // LoopOptions is a container for configuration for an event loop
 type LoopOptions struct {
-	// IncomingChannelSize is the size of the buffer for incoming events
+	// IncomingChannelSize is the size of the buffer for incoming events, counting those already
+	// queued by priority
 	IncomingChannelSize uint64
 
 	// ListenerChannelSize is the size of the buffer for new listeners
 	ListenerChannelSize uint64
 
-	// TTL is the default expiration set on new listeners
+	// TTL is the default expiration set on new listeners (see Loop.SetKeyTTL for what overrides it)
 	TTL time.Duration
 
 	// CleanupInterval is the interval at which cleanup is run (and expired listeners are pruned)
+	CleanupInterval time.Duration
+
+	// CleanupInteval is the old, misspelled name of CleanupInterval, used only if that is zero
+	//
+	// Deprecated: use CleanupInterval
 	CleanupInteval time.Duration
+
+	// MaxRegistrationsPerSecond caps the rate of new listeners; zero means unlimited
+	MaxRegistrationsPerSecond uint64
+
+	// QueueRateLimited makes registrations over the rate limit block until allowed, instead of
+	// failing with ErrRateLimited
+	QueueRateLimited bool
+
+	// MaxListenersPerKey caps the listeners waiting on any one key; zero means unlimited
+	MaxListenersPerKey int
+
+	// CloseSilentlyOnCancel makes cancelled listeners' channels just close, with CloseCause holding
+	// the reason; by default they receive an ErrCanceled (or context error) Event first
+	CloseSilentlyOnCancel bool
+
+	// DetectDoubleDelivery is a debugging aid that panics if any listener is notified twice; it
+	// remembers every listener ever notified, so it is not meant for production
+	DetectDoubleDelivery bool
+
+	// ManualRun skips starting the loop's goroutine; the caller must then run it with RunLoop
+	ManualRun bool
+
+	// MaxLifetime terminates the loop automatically once it has existed this long; zero means never
+	MaxLifetime time.Duration
+
+	// DeliveryWorkers is how many goroutines send events into listener channels for the loop, from
+	// a queue as long as IncomingChannelSize; zero means one per CPU. A send never blocks, since
+	// each listener channel has room for its event, so when the queue is full the loop only waits
+	// briefly for a worker to take the next one
+	DeliveryWorkers int
+
+	// IdleTimeout terminates the loop once it has gone this long with no listeners and no
+	// activity; zero means never
+	IdleTimeout time.Duration
+
+	// PriorityAging is how long a queued event waits to gain one level of Event.Priority, so that
+	// low priority events are not starved; the default is one second
+	PriorityAging time.Duration
+
+	// RequireExplicitTTL makes every wait that would fall back to the default TTL fail with
+	// ErrTTLRequired instead. A wait counts as having a TTL if the caller gave one (WaitTTL,
+	// WaitWithTimeoutAction...), if the key has one from SetKeyTTL, SetPrefixTTL or TTLFunc, or,
+	// for WaitContext, if ctx has a deadline; so helpers without a TTL argument, such as WaitAny or
+	// WaitN, are still usable on keys with a configured TTL. Subscriptions never expire, and are
+	// not affected
+	RequireExplicitTTL bool
+
+	// MaxListenerBytes caps the total of the sizes given to WaitSized across registered listeners;
+	// zero means unlimited
+	MaxListenerBytes int
+
+	// OnFire, if set, is called each time an event notifies listeners, with its key and how many
+	// it notified; it runs on the loop's goroutine, so it must not block
+	OnFire func(key string, notified int)
+
+	// Logger, if set, is told what the loop is doing, with a level ("debug", "info" or "warn"), a
+	// message and alternating keys and values: listeners registering, timing out and being
+	// terminated, events matching listeners, and TrySend dropping events on a full buffer. It runs
+	// on the loop's goroutine (TrySend's caller's for drops), so it must not block
+	Logger func(level, msg string, keyvals ...interface{})
+
+	// StickyTTL keeps an event that reached no listeners for this long, and hands it to the first
+	// listener to register on its key in that window; zero disables it
+	StickyTTL time.Duration
+
+	// TTLFunc, if set, picks the TTL for waits on a key that has no TTL of its own from SetKeyTTL or
+	// SetPrefixTTL; returning zero falls back to TTL
+	TTLFunc func(key string) time.Duration
+
+	// MaxTTL caps every listener's TTL, however it was chosen; zero means no cap
+	MaxTTL time.Duration
+
+	// Validate, if set, is called on every event before it is accepted; an event it returns an
+	// error for is not sent, and Send returns the error
+	Validate func(Event) error
+
+	// DirectDeliveryWhenBuffered makes the loop send an event straight into a listener channel that
+	// has room in its buffer, rather than from a goroutine; a channel without room still gets a
+	// goroutine, so the loop never blocks on a listener
+	DirectDeliveryWhenBuffered bool
+
+	// OrderedDelivery sends events into listener channels one at a time, from a single goroutine,
+	// in the order the loop delivers them, so the first listener to register on a key is the first
+	// to have its event; a listener whose channel has no room holds up every delivery after it, so
+	// throughput drops to that of the slowest reader. It takes precedence over DeliveryWorkers and
+	// DirectDeliveryWhenBuffered
+	OrderedDelivery bool
+
+	// CoalesceWindow, if set, collapses bursts of events on a key: the first event opens a window
+	// this long, and when it ends only the last event sent on the key during it is delivered
+	CoalesceWindow time.Duration
+
+	// PanicPolicy decides what happens if the loop's goroutine panics, in a hook or handler say;
+	// by default the loop is terminated, so that its listeners are not left waiting
+	PanicPolicy PanicPolicy
+
+	// Clock, if set, replaces the system clock for everything the loop times: listener TTLs, event
+	// times, the cleanup interval, MaxLifetime, IdleTimeout and CoalesceWindow, so tests can move
+	// time by hand; only the registration rate limit and Ping, which make their caller wait, still
+	// run on real time
+	Clock Clock
 }
 
 // New creates a new default event loop
@@ -72,135 +320,915 @@ func NewCustom(options *LoopOptions) *Loop {
 	if options.TTL == 0 {
 		options.TTL = 1 * time.Hour
 	}
-	if options.CleanupInteval == 0 {
-		options.CleanupInteval = 5 * time.Second
+	if options.CleanupInterval == 0 {
+		options.CleanupInterval = options.CleanupInteval
+	}
+	if options.CleanupInterval == 0 {
+		options.CleanupInterval = 5 * time.Second
+	}
+	if options.PriorityAging == 0 {
+		options.PriorityAging = 1 * time.Second
+	}
+	if options.Clock == nil {
+		options.Clock = realClock{}
 	}
 
 	loop := Loop{
-		incomingEvents:    make(chan Event, options.IncomingChannelSize),
-		incomingListeners: make(chan listener, options.ListenerChannelSize),
-		defaultTTL:        options.TTL,
-		listenerMap:       map[string][]listener{},
-		terminated:        false,
-		terminateChan:     make(chan struct{}, 1),
-		cleanupTicker:     time.NewTicker(options.CleanupInteval),
+		options:            *options,
+		defaultTTL:         options.TTL,
+		clock:              options.Clock,
+		queueRateLimited:   options.QueueRateLimited,
+		idleTimeout:        options.IdleTimeout,
+		maxListenersPerKey: options.MaxListenersPerKey,
+		closeOnCancel:      options.CloseSilentlyOnCancel,
+		directDelivery:     options.DirectDeliveryWhenBuffered,
+		coalesceWindow:     options.CoalesceWindow,
+		panicPolicy:        options.PanicPolicy,
+		validate:           options.Validate,
+		requireTTL:         options.RequireExplicitTTL,
+		maxListenerBytes:   options.MaxListenerBytes,
+		onFire:             options.OnFire,
+		logger:             options.Logger,
+		stickyTTL:          options.StickyTTL,
+		ttlFunc:            options.TTLFunc,
+		maxTTL:             options.MaxTTL,
+	}
+	if options.MaxRegistrationsPerSecond > 0 {
+		loop.registrations = newTokenBucket(float64(options.MaxRegistrationsPerSecond))
 	}
+	loop.reset()
 
-	go loop.run()
+	if !options.ManualRun {
+		go loop.RunLoop()
+	}
 
 	return &loop
 }
 
+// reset gives the loop the fresh state of a new one; its configuration carries over, as do the
+// counters, the TTLs set with SetKeyTTL and the close causes for CloseCause
+func (l *Loop) reset() {
+	options := &l.options
+	l.incomingEvents = make(chan sentEvent, options.IncomingChannelSize)
+	l.eventSlots = make(chan struct{}, options.IncomingChannelSize)
+	l.incomingListeners = make(chan listener, options.ListenerChannelSize)
+	l.listenerMap = map[string][]listener{}
+	l.prefixMap = map[string][]listener{}
+	l.waitStats = map[string]*waitSummary{}
+	l.idleWatchers = map[string][]chan struct{}{}
+	l.sequences = map[string]sequence{}
+	l.paused = map[string][]sentEvent{}
+	l.mirrors = map[uint64]*mirror{}
+	l.finished = map[uint64]finishedListener{}
+	l.sticky = map[string]stickyEvent{}
+	l.readySends = map[string][]*readySend{}
+	l.resumables = map[resumeToken]*resumable{}
+	l.coalescing = map[string]*coalesced{}
+	l.terminateChan = make(chan struct{})
+	l.terminateOnce = sync.Once{}
+	l.commands = make(chan func())
+	l.done = make(chan struct{})
+	l.cleanupTicker = options.Clock.NewTicker(options.CleanupInterval)
+	l.cleanupPaused = false
+	l.cleanupWatchers = nil
+	l.queue = eventQueue{aging: options.PriorityAging}
+	l.lastActive = l.now()
+	l.listenerBytes = 0
+	l.terminatedListeners = 0
+	l.notified, l.pool, l.ordered, l.lifetime, l.idleTimer, l.coalesceTimer = nil, nil, nil, nil, nil, nil
+	if options.DetectDoubleDelivery {
+		l.notified = map[uint64]bool{}
+	}
+	if options.OrderedDelivery {
+		l.ordered = &sequencer{}
+	} else {
+		workers := options.DeliveryWorkers
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		l.pool = newWorkerPool(workers, int(options.IncomingChannelSize))
+	}
+	if options.MaxLifetime > 0 {
+		l.lifetime = options.Clock.NewTimer(options.MaxLifetime)
+	}
+	if options.CoalesceWindow > 0 {
+		l.coalesceTimer = options.Clock.NewTimer(options.CoalesceWindow)
+		l.coalesceTimer.Stop()
+	}
+}
+
+// Reset brings a terminated loop back, as if NewCustom had just created it with the same
+// LoopOptions (under ManualRun, RunLoop must then be called again); SetKeyTTL overrides and the
+// event counters are kept. It returns ErrLoopRunning unless the loop has fully stopped, that is
+// once Done is closed, and it must not race with other calls on the loop. Done returns a new
+// channel for the new run, so callers holding the old one must call Done again
+func (l *Loop) Reset() error {
+	l.resetMu.Lock()
+	defer l.resetMu.Unlock()
+	select {
+	case <-l.done:
+	default:
+		return ErrLoopRunning
+	}
+	l.reset()
+	atomic.StoreInt32(&l.terminated, 0)
+	atomic.StoreInt32(&l.started, 0)
+	if !l.options.ManualRun {
+		go l.RunLoop()
+	}
+	return nil
+}
+
+// RunLoop runs the event loop on the calling goroutine, blocking until the loop is terminated
+// It is only needed for loops created with LoopOptions.ManualRun; calls after the first return at once
+func (l *Loop) RunLoop() {
+	if !atomic.CompareAndSwapInt32(&l.started, 0, 1) {
+		return
+	}
+	l.run()
+}
+
 // Wait registers a new listener, and returns a channel on which the Event will arrive
+// The TTL is the key's own, from SetKeyTTL, SetPrefixTTL or TTLFunc, if it has one; otherwise it
+// is the loop default, or under LoopOptions.RequireExplicitTTL the wait fails with ErrTTLRequired
 func (l *Loop) Wait(key string) <-chan Event {
-	return l.WaitTTL(key, l.defaultTTL)
+	lis := l.waitListener(key, 0)
+	l.register(lis)
+	return lis.Channel
 }
 
 // WaitTTL registers a new listener, and returns a channel on which the Event will arrive
-// the TTL argument overrides the configured TTL of the loop
+// the TTL argument overrides the configured TTL of the loop; a ttl <= 0 uses the key's TTL,
+// or fails with ErrTTLRequired under LoopOptions.RequireExplicitTTL
 func (l *Loop) WaitTTL(key string, ttl time.Duration) <-chan Event {
-	lis := listener{
-		Key:        key,
-		Expiration: time.Now().Add(l.defaultTTL),
-		Channel:    make(chan Event),
-	}
-	if !l.terminated {
-		l.incomingListeners <- lis
-	} else {
-		go func() {
-			lis.Channel <- Event{Key: key, Error: ErrLoopTerminated}
-			close(lis.Channel)
-		}()
+	if ttl <= 0 {
+		return l.Wait(key)
 	}
+	lis := l.waitListener(key, ttl)
+	l.register(lis)
 	return lis.Channel
 }
 
-// Send receives an Event and triggers any listeners with its key
-func (l *Loop) Send(e Event) {
-	if l.terminated {
+// WaitPrefix registers a listener that fires on the first event whose key starts with prefix, and
+// returns the channel on which the Event will arrive, with Key set to the event's full key
+func (l *Loop) WaitPrefix(prefix string) <-chan Event {
+	lis := l.waitListener(prefix, 0)
+	lis.Prefix = true
+	l.register(lis)
+	return lis.Channel
+}
+
+// WaitSized is Wait for a listener estimated to hold on to approxBytes; it fails with
+// ErrMemoryLimit if that would take the loop over LoopOptions.MaxListenerBytes
+func (l *Loop) WaitSized(key string, approxBytes int) <-chan Event {
+	lis := l.waitListener(key, 0)
+	lis.Bytes = approxBytes
+	l.register(lis)
+	return lis.Channel
+}
+
+// WaitErr is Wait, except that on a terminated loop it returns ErrLoopTerminated right away
+// instead of a channel
+func (l *Loop) WaitErr(key string) (<-chan Event, error) {
+	if l.isTerminated() {
+		return nil, ErrLoopTerminated
+	}
+	return l.Wait(key), nil
+}
+
+// register queues lis for the run goroutine, or fails it if the loop is down or rate limited
+func (l *Loop) register(lis listener) {
+	err := ErrLoopTerminated
+	if !l.isTerminated() {
+		err = l.admit(lis)
+	}
+	if err != nil {
+		l.fail(lis, err)
 		return
 	}
-	l.incomingEvents <- e
+	select {
+	case l.incomingListeners <- lis:
+		l.strand()
+	case <-l.done:
+		l.fail(lis, ErrLoopTerminated)
+	}
+}
+
+// fail notifies a listener that was never registered
+func (l *Loop) fail(lis listener, err error) {
+	l.handOff(lis, Event{Key: lis.Key, Error: err})
+}
+
+// Send receives an Event and triggers any listeners with its key; it returns the error from
+// LoopOptions.Validate if the event is rejected, or ErrLoopTerminated if the loop is down
+// Send blocks while the incoming buffer is full, but never once the loop has stopped
+func (l *Loop) Send(e Event) error {
+	if err := l.check(e); err != nil {
+		return err
+	}
+	return l.post(sentEvent{event: e})
+}
+
+// post hands e to the run goroutine, or counts it as dropped, closing its acknowledgement, if the
+// loop is down
+func (l *Loop) post(e sentEvent) error {
+	if l.isTerminated() {
+		atomic.AddUint64(&l.counters.dropped, 1)
+		if e.ack != nil {
+			close(e.ack)
+		}
+		return ErrLoopTerminated
+	}
+	atomic.AddUint64(&l.counters.sent, 1)
+	e.event.sent = l.now()
+	select {
+	case l.eventSlots <- struct{}{}:
+		// Holding a slot, there is room in incomingEvents
+		l.incomingEvents <- e
+		if !l.strand() {
+			return nil
+		}
+		// Whichever drain took e has closed its acknowledgement
+	case <-l.done:
+		if e.ack != nil {
+			close(e.ack)
+		}
+	}
+	atomic.AddUint64(&l.counters.sent, ^uint64(0))
+	atomic.AddUint64(&l.counters.dropped, 1)
+	return ErrLoopTerminated
+}
+
+// TrySend is Send without blocking: it returns false at once, dropping the event, if the incoming
+// buffer is full, the loop is down or LoopOptions.Validate rejects the event
+func (l *Loop) TrySend(e Event) bool {
+	if l.check(e) != nil {
+		return false
+	}
+	if l.isTerminated() {
+		atomic.AddUint64(&l.counters.dropped, 1)
+		return false
+	}
+	atomic.AddUint64(&l.counters.sent, 1)
+	e.sent = l.now()
+	select {
+	case l.eventSlots <- struct{}{}:
+		l.incomingEvents <- sentEvent{event: e}
+		if l.strand() {
+			atomic.AddUint64(&l.counters.sent, ^uint64(0))
+			atomic.AddUint64(&l.counters.dropped, 1)
+			return false
+		}
+		return true
+	default:
+		atomic.AddUint64(&l.counters.sent, ^uint64(0))
+		atomic.AddUint64(&l.counters.dropped, 1)
+		if l.logger != nil {
+			l.logger("warn", "event dropped, buffer full", "key", e.Key)
+		}
+		return false
+	}
+}
+
+// Reply sends e as a response to cause, linking the two through e.CausedBy
+func (l *Loop) Reply(cause Event, e Event) error {
+	e.CausedBy = cause.ID
+	return l.Send(e)
+}
+
+// check runs LoopOptions.Validate on e, if there is one
+func (l *Loop) check(e Event) error {
+	if l.validate == nil {
+		return nil
+	}
+	return l.validate(e)
 }
 
-// Terminate stops the event loop and cancels any listeners
+// PauseCleanup stops listeners from timing out until ResumeCleanup, while events keep flowing
+func (l *Loop) PauseCleanup() {
+	l.exec(func() { l.cleanupPaused = true })
+}
+
+// ResumeCleanup lets listeners time out again; any that came due during the pause expire on the
+// next cleanup
+func (l *Loop) ResumeCleanup() {
+	l.exec(func() { l.cleanupPaused = false })
+}
+
+// TimeoutKeys immediately times out every listener on the given keys, as if their TTL had passed,
+// and returns how many were notified
+func (l *Loop) TimeoutKeys(keys []string) int {
+	return l.endKeys(keys, ErrTimedOut)
+}
+
+// endKeys removes every listener on the given keys, notifying each with err, and returns how many
+// there were
+func (l *Loop) endKeys(keys []string, err error) int {
+	count := make(chan int, 1)
+	ok := l.exec(func() {
+		var batch []listener
+		for _, key := range keys {
+			batch = append(batch, l.listenerMap[key]...)
+			delete(l.listenerMap, key)
+		}
+		atomic.AddInt64(&l.counters.listeners, -int64(len(batch)))
+		// Counted even if a hook panics while the batch is notified
+		defer func() { count <- len(batch) }()
+		l.notify(batch, err)
+	})
+	if !ok {
+		return 0
+	}
+	return <-count
+}
+
+// Done returns a channel that is closed once the loop has stopped and every outstanding listener
+// has been notified; it is the same channel on every call until Reset starts a new run
+func (l *Loop) Done() <-chan struct{} {
+	return l.done
+}
+
+// Terminate stops the event loop and cancels any listeners; it returns at once, and calls after
+// the first do nothing
 func (l *Loop) Terminate() {
-	l.terminateChan <- struct{}{}
+	l.terminateOnce.Do(func() { close(l.terminateChan) })
+}
+
+// Ping checks that the run goroutine is responsive, returning false if it doesn't acknowledge a
+// no-op command within the timeout or the loop is terminated
+func (l *Loop) Ping(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	ack := make(chan struct{})
+	select {
+	case l.commands <- func() { close(ack) }:
+	case <-l.done:
+		return false
+	case <-timer.C:
+		return false
+	}
+	select {
+	case <-ack:
+		return true
+	case <-timer.C:
+		return false
+	}
 }
 
 func (l *Loop) run() {
-	for !l.terminated {
+	var expired <-chan time.Time
+	if l.lifetime != nil {
+		expired = l.lifetime.C()
+		defer l.lifetime.Stop()
+	}
+	var idle <-chan time.Time
+	if l.idleTimeout > 0 {
+		idleTimer := l.clock.NewTimer(l.idleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C()
+		l.idleTimer = idleTimer
+	}
+	var coalesced <-chan time.Time
+	if l.coalesceTimer != nil {
+		coalesced = l.coalesceTimer.C()
+		defer l.coalesceTimer.Stop()
+	}
+	defer l.cleanupTicker.Stop()
+
+	for !l.isTerminated() {
+		l.serve(expired, idle, coalesced)
+	}
+	p := l.terminate()
+	l.dropQueued()
+	l.stopMirrors()
+	if l.pool != nil {
+		l.pool.stop()
+	}
+	// Done promises every listener has its event, so the deliveries still queued have to land first
+	<-l.sends.wait()
+	close(l.done)
+	// The loop is stopping anyway, so only PanicPropagate has anything left to do with a panic
+	if l.panicPolicy == PanicPropagate {
+		p.raise()
+	}
+}
+
+// serve handles the loop's channels until it is terminated, or until something it runs panics
+func (l *Loop) serve(expired, idle, coalesced <-chan time.Time) {
+	defer l.recoverPanic()
+	for !l.isTerminated() {
+		queued := (<-chan struct{})(nil)
+		if l.queue.Len() > 0 {
+			queued = ready
+		}
+
 		select {
 		case <-l.terminateChan:
-			l.terminated = true
+			atomic.StoreInt32(&l.terminated, 1)
+		case <-expired:
+			atomic.StoreInt32(&l.terminated, 1)
+		case <-idle:
+			l.checkIdle()
+		case <-coalesced:
+			l.releaseCoalesced(false)
 		case lis := <-l.incomingListeners:
+			l.lastActive = l.now()
 			l.registerListener(lis)
 		case e := <-l.incomingEvents:
-			l.processEvent(e)
-		case <-l.cleanupTicker.C:
-			l.cleanup()
+			l.lastActive = l.now()
+			l.enqueue(e)
+		case <-queued:
+			l.dispatch(l.dequeue())
+		case fn := <-l.commands:
+			fn()
+		case <-l.cleanupTicker.C():
+			if !l.cleanupPaused {
+				// Events already sent win over expiry: a listener whose event is queued gets it,
+				// even if its TTL ran out in the meantime
+				l.flushEvents()
+				l.cleanup()
+			}
+		}
+		l.notifyIdle()
+	}
+}
+
+// checkIdle terminates the loop under LoopOptions.IdleTimeout if it has had no listeners and no
+// activity for the whole timeout, and otherwise rearms the timer for when it next could have
+func (l *Loop) checkIdle() {
+	next := l.idleTimeout
+	busy := len(l.listenerMap) > 0 || len(l.prefixMap) > 0 || l.queue.Len() > 0 || len(l.paused) > 0 ||
+		len(l.coalescing) > 0
+	if !busy {
+		quiet := l.now().Sub(l.lastActive)
+		if quiet >= l.idleTimeout {
+			atomic.StoreInt32(&l.terminated, 1)
+			return
+		}
+		next = l.idleTimeout - quiet
+	}
+	l.idleTimer.Reset(next)
+}
+
+// isTerminated reports whether run has stopped, or is stopping; it is safe from any goroutine
+func (l *Loop) isTerminated() bool {
+	return atomic.LoadInt32(&l.terminated) != 0
+}
+
+// exec runs fn on the run goroutine, returning false if the loop terminated before it could
+func (l *Loop) exec(fn func()) bool {
+	if l.isTerminated() {
+		return false
+	}
+	select {
+	case l.commands <- fn:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// waitListener is newListener for a wait on key given ttl, or the key's own TTL if ttl <= 0
+func (l *Loop) waitListener(key string, ttl time.Duration) listener {
+	lis := l.newListener(key, l.ttlFor(key, ttl))
+	lis.DefaultTTL = ttl <= 0 && l.configuredTTL(key) <= 0
+	return lis
+}
+
+func (l *Loop) newListener(key string, ttl time.Duration) listener {
+	now := l.now()
+	return listener{
+		ID:         atomic.AddUint64(&l.nextID, 1),
+		Key:        key,
+		Registered: now,
+		Expiration: now.Add(ttl),
+		// Buffered for the single final event, so delivery never parks on an abandoned channel
+		Channel: make(chan Event, 1),
+	}
+}
+
+// deliver hands e to lis, which must already be out of listenerMap
+func (l *Loop) deliver(lis listener, e Event) {
+	l.settle(lis, e)
+	l.handOff(lis, e)
+}
+
+// handOff passes a listener's final event to whatever consumes it
+func (l *Loop) handOff(lis listener, e Event) {
+	switch {
+	case lis.End != nil:
+		lis.End(e.Error)
+	case lis.Handler != nil:
+		lis.Handler(e)
+	default:
+		l.send(lis.Channel, e)
+	}
+}
+
+// settle does the bookkeeping for a listener receiving its final event e
+func (l *Loop) settle(lis listener, e Event) {
+	l.listenerBytes -= lis.Bytes
+	if l.notified != nil {
+		if l.notified[lis.ID] {
+			panic(fmt.Sprintf("waitloop: listener %d on key %q notified twice", lis.ID, lis.Key))
+		}
+		l.notified[lis.ID] = true
+	}
+	if lis.Tracked {
+		l.finished[lis.ID] = finishedListener{status: lis.status(true, e.Error), at: l.now()}
+	}
+}
+
+// notify delivers err to a batch of removed listeners; the channel sends are spawned from a
+// separate goroutine so that a large batch does not stall run, unless they can go direct
+func (l *Loop) notify(batch []listener, err error) {
+	if err == ErrTimedOut {
+		atomic.AddUint64(&l.counters.timedOut, uint64(len(batch)))
+		if l.logger != nil {
+			for _, lis := range batch {
+				l.logger("info", "listener timed out", "key", lis.Key, "id", lis.ID)
+			}
 		}
 	}
-	l.terminate()
+	var channels []listener
+	p := each(batch, func(lis listener) {
+		e := Event{Key: lis.Key, Error: err}
+		l.settle(lis, e)
+		if lis.End != nil || lis.Handler != nil {
+			l.handOff(lis, e)
+			return
+		}
+		channels = append(channels, lis)
+	})
+	// Channels never panic, so they are sent to first
+	defer p.raise()
+	if len(channels) == 0 {
+		return
+	}
+	if l.directDelivery {
+		for _, lis := range channels {
+			l.send(lis.Channel, Event{Key: lis.Key, Error: err})
+		}
+		return
+	}
+	// Held open until every send has started, so Done cannot close partway through the batch
+	l.sends.start()
+	l.spawn(func() {
+		defer l.sends.finish()
+		for _, lis := range channels {
+			l.send(lis.Channel, Event{Key: lis.Key, Error: err})
+		}
+	})
+}
+
+// send hands the final event to a listener channel and closes it, through the delivery pool unless
+// LoopOptions.DirectDeliveryWhenBuffered lets it go straight into the channel's buffer; a send
+// after the loop has stopped gets a goroutine of its own
+func (l *Loop) send(ch chan Event, e Event) {
+	if e.Error != nil {
+		l.causes.record(ch, e.Error, l.now())
+	}
+	if canceled(e.Error) && l.closeOnCancel {
+		close(ch)
+		return
+	}
+	if l.directDelivery && l.ordered == nil {
+		select {
+		case ch <- e:
+			close(ch)
+			return
+		default:
+		}
+	}
+	l.inflight.start()
+	l.sends.start()
+	job := func() {
+		defer l.inflight.finish()
+		defer l.sends.finish()
+		ch <- e
+		close(ch)
+	}
+	switch {
+	case l.ordered != nil:
+		l.ordered.submit(job)
+	case !l.pool.submit(job):
+		// The loop has stopped
+		go job()
+	}
+}
+
+// canceled reports whether err means the listener was cancelled, rather than reaching an outcome
+func canceled(err error) bool {
+	return err == ErrCanceled || err == context.Canceled || err == context.DeadlineExceeded
+}
+
+// spawn runs fn on a new goroutine that Shutdown waits for
+func (l *Loop) spawn(fn func()) {
+	l.inflight.start()
+	go func() {
+		defer l.inflight.finish()
+		fn()
+	}()
+}
+
+// removeListener drops the listener with the given id without notifying it
+func (l *Loop) removeListener(key string, id uint64) bool {
+	for i, lis := range l.listenerMap[key] {
+		if lis.ID != id {
+			continue
+		}
+		l.listenerMap[key] = append(l.listenerMap[key][:i:i], l.listenerMap[key][i+1:]...)
+		if len(l.listenerMap[key]) == 0 {
+			delete(l.listenerMap, key)
+		}
+		atomic.AddInt64(&l.counters.listeners, -1)
+		return true
+	}
+	return false
 }
 
 func (l *Loop) registerListener(lis listener) {
-	if _, ok := l.listenerMap[lis.Key]; !ok {
-		l.listenerMap[lis.Key] = []listener{lis}
+	listeners := l.listenerMap
+	if lis.Prefix {
+		listeners = l.prefixMap
+	}
+	if l.maxListenersPerKey > 0 && len(listeners[lis.Key]) >= l.maxListenersPerKey {
+		l.reject(lis, ErrTooManyListeners)
+		return
+	}
+	if l.maxListenerBytes > 0 && l.listenerBytes+lis.Bytes > l.maxListenerBytes {
+		l.reject(lis, ErrMemoryLimit)
+		return
+	}
+	if !lis.Prefix && l.takeSticky(&lis) {
+		return
+	}
+	l.listenerBytes += lis.Bytes
+	if _, ok := listeners[lis.Key]; !ok {
+		listeners[lis.Key] = []listener{lis}
 	} else {
-		l.listenerMap[lis.Key] = append(l.listenerMap[lis.Key], lis)
+		listeners[lis.Key] = append(listeners[lis.Key], lis)
+	}
+	atomic.AddInt64(&l.counters.listeners, 1)
+	atomic.AddUint64(&l.counters.registered, 1)
+	if lis.Trace != nil {
+		lis.Trace(TraceRegistered, nil)
+	}
+	if l.logger != nil {
+		l.logger("debug", "listener registered", "key", lis.Key, "id", lis.ID)
+	}
+	if !lis.Prefix {
+		l.releaseReady(lis.Key)
 	}
 }
 
-func (l *Loop) processEvent(e Event) {
-	waiters, ok := l.listenerMap[e.Key]
+// reject fails a listener that registerListener turned away
+func (l *Loop) reject(lis listener, err error) {
+	lis.Bytes = 0 // never counted
+	l.deliver(lis, Event{Key: lis.Key, Error: err})
+}
+
+// processEvent delivers e to the listeners on its key that match, as fire does, and reports it to
+// the event's mirrors and LoopOptions hooks
+func (l *Loop) processEvent(e Event, match func(listener) bool) int {
+	if !e.Expiration.IsZero() && l.now().After(e.Expiration) {
+		atomic.AddUint64(&l.counters.dropped, 1)
+		return 0
+	}
+	if e.ID == "" {
+		e.ID = strconv.FormatUint(atomic.AddUint64(&l.nextID, 1), 10)
+	}
+	l.mirror(e)
+	notified := l.fire(e, match)
+	if notified > 0 && l.onFire != nil {
+		l.onFire(e.Key, notified)
+	}
+	if notified > 0 && l.logger != nil {
+		l.logger("debug", "event matched", "key", e.Key, "listeners", notified)
+	}
+	return notified
+}
+
+// fire delivers e to the listeners on its key that match (all of them if match is nil), and
+// returns how many were notified; listeners that don't match stay registered
+func (l *Loop) fire(e Event, match func(listener) bool) int {
+	atomic.AddUint64(&l.counters.processed, 1)
+	e.Seq = l.nextSeq(e.Key)
+
+	notified := l.fireIn(l.listenerMap, e.Key, e, match)
+	// Look up each prefix of the key, so the cost doesn't grow with the number of prefix listeners
+	for i := 0; i <= len(e.Key) && len(l.prefixMap) > 0; i++ {
+		notified += l.fireIn(l.prefixMap, e.Key[:i], e, match)
+	}
+
+	if notified > 0 {
+		atomic.AddUint64(&l.counters.matched, 1)
+	} else {
+		atomic.AddUint64(&l.counters.dropped, 1)
+		if match == nil {
+			l.stick(e)
+		}
+	}
+	return notified
+}
+
+// sequence is the last Seq given out on a key, and when
+type sequence struct {
+	last uint64
+	at   time.Time
+}
+
+func (l *Loop) nextSeq(key string) uint64 {
+	s := l.sequences[key]
+	s.last++
+	s.at = l.now()
+	l.sequences[key] = s
+	return s.last
+}
+
+// pruneSequences forgets the sequences of keys that have had no events since before, unless
+// listeners are still waiting on them
+func (l *Loop) pruneSequences(before time.Time) {
+	for key, s := range l.sequences {
+		if s.at.Before(before) && len(l.listenerMap[key]) == 0 {
+			delete(l.sequences, key)
+		}
+	}
+}
+
+// fireIn delivers e to the matching listeners stored under name in listeners, which is either
+// listenerMap or prefixMap, and returns how many were notified
+func (l *Loop) fireIn(listeners map[string][]listener, name string, e Event, match func(listener) bool) int {
+	waiters, ok := listeners[name]
 	if !ok {
-		return
+		return 0
+	}
+	// A listener that had not expired when the event was sent still gets it
+	at := e.sent
+	if at.IsZero() {
+		at = l.now()
+	}
+	// Filters that panic are remembered, so their listeners can be told instead of getting e
+	var failed map[uint64]bool
+	filtered := func(w listener) bool {
+		if match != nil && !match(w) {
+			return false
+		}
+		ok, panicked := w.accepts(e)
+		if panicked {
+			if failed == nil {
+				failed = map[uint64]bool{}
+			}
+			failed[w.ID] = true
+		}
+		return ok
+	}
+	notified, kept := l.route(waiters, at, filtered)
+	if len(kept) > 0 {
+		listeners[name] = kept
+	} else {
+		delete(listeners, name)
 	}
-	delete(l.listenerMap, e.Key)
 
-	for _, w := range waiters {
-		if w.Expiration.Before(time.Now()) {
+	atomic.AddInt64(&l.counters.listeners, -int64(len(waiters)-len(kept)))
+	atomic.AddUint64(&l.counters.delivered, uint64(len(notified)-len(failed)))
+	each(notified, func(w listener) {
+		switch {
+		case failed[w.ID]:
+			l.deliver(w, Event{Key: w.Key, Error: ErrFilterPanic})
+		case w.Persistent || w.Remaining > 1:
+			w.Handler(e)
+		default:
+			l.recordWait(w)
+			l.deliver(w, e)
+		}
+	}).raise()
+	return len(notified) - len(failed)
+}
+
+// route splits the listeners on a key into those an event notifies and those that stay registered;
+// expired listeners stay, for cleanup to time out
+func (l *Loop) route(waiters []listener, now time.Time, match func(listener) bool) (notified, kept []listener) {
+	matches := func(w listener) bool {
+		return !l.expired(w, now) && (match == nil || match(w))
+	}
+
+	// Only one worker takes the event: the highest priority one, or the earliest among equals
+	worker := -1
+	for i, w := range waiters {
+		if w.Worker && matches(w) && (worker < 0 || w.Priority > waiters[worker].Priority) {
+			worker = i
+		}
+	}
+
+	for i, w := range waiters {
+		if !matches(w) || w.Worker && i != worker {
+			kept = append(kept, w)
 			continue
 		}
-		go func(capturedW listener) {
-			capturedW.Channel <- e
-			close(capturedW.Channel)
-		}(w)
+		notified = append(notified, w)
+		if w.Persistent {
+			kept = append(kept, w)
+		} else if w.Remaining > 1 {
+			w.Remaining--
+			kept = append(kept, w)
+		}
 	}
+	return notified, kept
 }
 
-func (l *Loop) cleanup() {
-	for k := range l.listenerMap {
-		for i := range l.listenerMap[k] {
-			if time.Now().Before(l.listenerMap[k][i].Expiration) {
+// expired reports whether lis is past its TTL; nothing expires while cleanup is paused
+func (l *Loop) expired(lis listener, now time.Time) bool {
+	return !l.cleanupPaused && !lis.Persistent && lis.Expiration.Before(now)
+}
+
+// cleanup expires listeners past their TTL and returns how many it timed out
+func (l *Loop) cleanup() int {
+	now := l.now()
+	expired := l.expire(l.listenerMap, now, nil)
+	expired = l.expire(l.prefixMap, now, expired)
+	atomic.AddInt64(&l.counters.listeners, -int64(len(expired)))
+	l.notify(expired, ErrTimedOut)
+	l.pruneWaitStats()
+	l.pruneSticky(now)
+	l.pruneResumables(now)
+	l.causes.prune(now.Add(-l.defaultTTL))
+	l.pruneFinished(now.Add(-l.defaultTTL))
+	l.pruneSequences(now.Add(-l.defaultTTL))
+
+	result := CleanupResult{
+		TimedOut:      len(expired),
+		TimedOutByKey: map[string]int{},
+		Remaining:     int(atomic.LoadInt64(&l.counters.listeners)),
+	}
+	for _, lis := range expired {
+		result.TimedOutByKey[lis.Key]++
+	}
+	for _, w := range l.cleanupWatchers {
+		w <- result
+	}
+	l.cleanupWatchers = nil
+	return len(expired)
+}
+
+// expire removes the expired listeners from listeners, appending them to expired
+func (l *Loop) expire(listeners map[string][]listener, now time.Time, expired []listener) []listener {
+	for k, waiters := range listeners {
+		// Build a fresh slice of the survivors rather than splicing the one being ranged over
+		var kept []listener
+		for _, lis := range waiters {
+			if l.expired(lis, now) {
+				expired = append(expired, lis)
 				continue
 			}
-
-			go func(lis listener) {
-				lis.Channel <- Event{Key: k, Error: ErrTimedOut}
-				close(lis.Channel)
-			}(l.listenerMap[k][i])
-			l.listenerMap[k] = append(l.listenerMap[k][:i], l.listenerMap[k][i+1:]...)
+			if lis.Trace != nil {
+				lis.Trace(TraceCleanupSkipped, nil)
+			}
+			kept = append(kept, lis)
 		}
 
-		if len(l.listenerMap[k]) == 0 {
-			delete(l.listenerMap, k)
+		if len(kept) == 0 {
+			delete(listeners, k)
+		} else if len(kept) < len(waiters) {
+			listeners[k] = kept
 		}
 	}
+	return expired
 }
 
-func (l *Loop) terminate() {
-	for k := range l.listenerMap {
-		for i := range l.listenerMap[k] {
-			go func(lis listener) {
-				lis.Channel <- Event{Key: k, Error: ErrLoopTerminated}
-				close(lis.Channel)
-			}(l.listenerMap[k][i])
-			l.listenerMap[k] = append(l.listenerMap[k][:i], l.listenerMap[k][:i+1]...)
-		}
-		if len(l.listenerMap[k]) == 0 {
-			delete(l.listenerMap, k)
+// terminate delivers ErrLoopTerminated to every listener, including those still buffered on
+// their way in, and clears the map; it returns the first panic from a listener's hook, if any
+func (l *Loop) terminate() *caught {
+	var all []listener
+	for _, listeners := range l.listenerMap {
+		all = append(all, listeners...)
+	}
+	for _, listeners := range l.prefixMap {
+		all = append(all, listeners...)
+	}
+	for buffered := true; buffered; {
+		select {
+		case lis := <-l.incomingListeners:
+			lis.Bytes = 0 // never counted
+			all = append(all, lis)
+		default:
+			buffered = false
 		}
 	}
+	l.listenerMap = map[string][]listener{}
+	l.prefixMap = map[string][]listener{}
+	atomic.StoreInt64(&l.counters.listeners, 0)
+
+	// Higher priority listeners are notified first
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Priority > all[j].Priority })
+	p := each(all, func(lis listener) {
+		if l.logger != nil {
+			l.logger("debug", "listener terminated", "key", lis.Key, "id", lis.ID)
+		}
+		l.deliver(lis, Event{Key: lis.Key, Error: ErrLoopTerminated})
+	})
+	l.terminatedListeners = len(all)
+	atomic.AddUint64(&l.counters.terminated, uint64(len(all)))
+	return p
 }
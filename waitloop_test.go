@@ -0,0 +1,203 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+	"github.com/fsufitch/waitloop/fakeclock"
+)
+
+// patience bounds how long a test waits for something that should happen promptly
+const patience = 2 * time.Second
+
+// newLoop creates a loop that is terminated when the test ends
+func newLoop(t *testing.T, options *waitloop.LoopOptions) *waitloop.Loop {
+	t.Helper()
+	l := waitloop.NewCustom(options)
+	t.Cleanup(l.Terminate)
+	return l
+}
+
+// newFakeLoop creates a loop on a fake clock, with a one second cleanup interval unless options
+// set another
+func newFakeLoop(t *testing.T, options *waitloop.LoopOptions) (*waitloop.Loop, *fakeclock.Clock) {
+	t.Helper()
+	if options == nil {
+		options = &waitloop.LoopOptions{}
+	}
+	clock := fakeclock.New(time.Unix(1000, 0))
+	options.Clock = clock
+	if options.CleanupInterval == 0 {
+		options.CleanupInterval = time.Second
+	}
+	return newLoop(t, options), clock
+}
+
+// advance moves clock forward by d and returns once the loop has handled every tick and timer
+// that fired
+func advance(t *testing.T, l *waitloop.Loop, clock *fakeclock.Clock, d time.Duration) {
+	t.Helper()
+	clock.Advance(d)
+	waitUntil(t, "the loop to read the clock's ticks", clock.Delivered)
+	// run handles one thing at a time, so once a ping gets through it has finished with the ticks
+	l.Ping(patience)
+}
+
+// waitUntil polls cond until it holds, failing the test if it takes too long
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(patience)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitListeners waits until the loop has n listeners registered
+func waitListeners(t *testing.T, l *waitloop.Loop, n int) {
+	t.Helper()
+	waitUntil(t, "listeners to register", func() bool { return l.ListenerCount() == n })
+}
+
+// recv reads one Event from ch, failing the test if none arrives or ch is closed
+func recv(t *testing.T, ch <-chan waitloop.Event) waitloop.Event {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed without an event")
+		}
+		return e
+	case <-time.After(patience):
+		t.Fatal("timed out waiting for an event")
+	}
+	return waitloop.Event{}
+}
+
+// noRecv fails the test if ch yields anything within a short while
+func noRecv(t *testing.T, ch <-chan waitloop.Event) {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		if ok {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		t.Fatal("channel closed unexpectedly")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// closed fails the test unless ch is closed without yielding any more events
+func closed(t *testing.T, ch <-chan waitloop.Event) {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		if ok {
+			t.Fatalf("expected channel to close, got %+v", e)
+		}
+	case <-time.After(patience):
+		t.Fatal("timed out waiting for the channel to close")
+	}
+}
+
+// cancelled fails the test unless ch yields one Event carrying err and then closes
+func cancelled(t *testing.T, ch <-chan waitloop.Event, err error) {
+	t.Helper()
+	if e := recv(t, ch); e.Error != err {
+		t.Fatalf("got %+v, want %v", e, err)
+	}
+	closed(t, ch)
+}
+
+// send sends e and waits until the loop has processed it, returning how many listeners it reached
+func send(t *testing.T, l *waitloop.Loop, e waitloop.Event) int {
+	t.Helper()
+	select {
+	case n := <-l.SendAck(e):
+		return n
+	case <-time.After(patience):
+		t.Fatal("timed out waiting for the event to be processed")
+	}
+	return 0
+}
+
+// stopped fails the test unless the loop stops promptly
+func stopped(t *testing.T, l *waitloop.Loop) {
+	t.Helper()
+	select {
+	case <-l.Done():
+	case <-time.After(patience):
+		t.Fatal("loop did not stop")
+	}
+}
+
+func TestPingHealthyLoop(t *testing.T) {
+	l := newLoop(t, nil)
+	if !l.Ping(patience) {
+		t.Fatal("Ping failed on a healthy loop")
+	}
+}
+
+func TestPingBlockedLoop(t *testing.T) {
+	l := newLoop(t, nil)
+	entered, block := make(chan struct{}), make(chan struct{})
+	defer close(block)
+	// The hook runs on the run goroutine, and holds it up until the test ends
+	l.WaitWithRemoveHook("key", func(error) {
+		close(entered)
+		<-block
+	})
+	waitListeners(t, l, 1)
+	l.Send(waitloop.Event{Key: "key"})
+	<-entered
+
+	start := time.Now()
+	if l.Ping(50 * time.Millisecond) {
+		t.Fatal("Ping succeeded while the loop was blocked")
+	}
+	if elapsed := time.Since(start); elapsed > patience {
+		t.Fatalf("Ping took %v to time out", elapsed)
+	}
+}
+
+func TestPingTerminatedLoop(t *testing.T) {
+	l := newLoop(t, nil)
+	l.Terminate()
+	stopped(t, l)
+	if l.Ping(patience) {
+		t.Fatal("Ping succeeded on a terminated loop")
+	}
+}
+
+func TestManualRun(t *testing.T) {
+	l := newLoop(t, &waitloop.LoopOptions{ManualRun: true})
+	ch := l.Wait("key")
+	if err := l.Send(waitloop.Event{Key: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if l.ListenerCount() != 0 {
+		t.Fatal("listener registered before RunLoop")
+	}
+
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		l.RunLoop()
+	}()
+	waitListeners(t, l, 1)
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	if e := recv(t, ch); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+
+	l.Terminate()
+	select {
+	case <-returned:
+	case <-time.After(patience):
+		t.Fatal("RunLoop did not return after Terminate")
+	}
+	stopped(t, l)
+}
@@ -0,0 +1,71 @@
+package waitloop_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestWaitNOneIsWait(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitN("key", 1)
+	waitListeners(t, l, 1)
+
+	if n := send(t, l, waitloop.Event{Key: "key", Data: 1}); n != 1 {
+		t.Fatalf("event reached %d listeners, want 1", n)
+	}
+	if e := recv(t, ch); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+	closed(t, ch)
+	if n := send(t, l, waitloop.Event{Key: "key"}); n != 0 {
+		t.Fatalf("second event reached %d listeners, want 0", n)
+	}
+}
+
+func TestWaitNStreamsNEvents(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitN("key", 3)
+	waitListeners(t, l, 1)
+
+	for i := 0; i < 4; i++ {
+		send(t, l, waitloop.Event{Key: "key", Data: i})
+	}
+	for i := 0; i < 3; i++ {
+		if e := recv(t, ch); e.Error != nil || e.Data != i {
+			t.Fatalf("got %+v, want event %d", e, i)
+		}
+	}
+	closed(t, ch)
+}
+
+func TestWaitNTimesOutMidStream(t *testing.T) {
+	l, clock := newFakeLoop(t, &waitloop.LoopOptions{TTL: time.Minute})
+	ch := l.WaitN("key", 3)
+	waitListeners(t, l, 1)
+
+	send(t, l, waitloop.Event{Key: "key", Data: 0})
+	advance(t, l, clock, 2*time.Minute)
+	if e := recv(t, ch); e.Data != 0 {
+		t.Fatalf("got %+v, want the first event", e)
+	}
+	if e := recv(t, ch); e.Error != waitloop.ErrTimedOut {
+		t.Fatalf("got %v, want ErrTimedOut", e.Error)
+	}
+	closed(t, ch)
+}
+
+func TestWaitNTerminatedMidStream(t *testing.T) {
+	l := newLoop(t, nil)
+	ch := l.WaitN("key", 3)
+	waitListeners(t, l, 1)
+
+	send(t, l, waitloop.Event{Key: "key", Data: 0})
+	l.Terminate()
+	recv(t, ch)
+	if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+		t.Fatalf("got %v, want ErrLoopTerminated", e.Error)
+	}
+	closed(t, ch)
+}
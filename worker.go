@@ -0,0 +1,23 @@
+package waitloop
+
+// WaitWork registers a worker listener on key and returns the channel on which its Event will arrive
+// Unlike Wait, each event on the key goes to only one worker: the one with the highest priority, or
+// the longest waiting among equal priorities; the other workers stay registered for the next event
+// Listeners registered with Wait still receive every event alongside the chosen worker
+func (l *Loop) WaitWork(key string, priority int) <-chan Event {
+	lis := l.waitListener(key, 0)
+	lis.Priority = priority
+	lis.Worker = true
+
+	l.register(lis)
+	return lis.Channel
+}
+
+// WaitPriority is Wait for a listener with a priority; when the loop terminates, higher priority
+// listeners are notified before lower ones
+func (l *Loop) WaitPriority(key string, priority int) <-chan Event {
+	lis := l.waitListener(key, 0)
+	lis.Priority = priority
+	l.register(lis)
+	return lis.Channel
+}
@@ -0,0 +1,95 @@
+package waitloop_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fsufitch/waitloop"
+)
+
+func TestWorkEventsGoToTheHighestPriority(t *testing.T) {
+	l := newLoop(t, nil)
+	low := l.WaitWork("key", 1)
+	high := l.WaitWork("key", 5)
+	mid := l.WaitWork("key", 3)
+	waitListeners(t, l, 3)
+
+	for i, ch := range []<-chan waitloop.Event{high, mid, low} {
+		if n := send(t, l, waitloop.Event{Key: "key", Data: i}); n != 1 {
+			t.Fatalf("event %d reached %d workers, want 1", i, n)
+		}
+		if e := recv(t, ch); e.Data != i {
+			t.Fatalf("got %v, want %d", e.Data, i)
+		}
+		if i < 2 {
+			waitListeners(t, l, 2-i)
+		}
+	}
+	waitListeners(t, l, 0)
+}
+
+func TestWorkEventsGoToTheLongestWaitingAmongEquals(t *testing.T) {
+	l := newLoop(t, nil)
+	first := l.WaitWork("key", 2)
+	waitListeners(t, l, 1)
+	second := l.WaitWork("key", 2)
+	waitListeners(t, l, 2)
+
+	send(t, l, waitloop.Event{Key: "key", Data: 1})
+	if e := recv(t, first); e.Data != 1 {
+		t.Fatalf("got %v, want 1", e.Data)
+	}
+	noRecv(t, second)
+	send(t, l, waitloop.Event{Key: "key", Data: 2})
+	if e := recv(t, second); e.Data != 2 {
+		t.Fatalf("got %v, want 2", e.Data)
+	}
+}
+
+func TestWorkEventsStillReachOrdinaryListeners(t *testing.T) {
+	l := newLoop(t, nil)
+	worker := l.WaitWork("key", 1)
+	idle := l.WaitWork("key", 0)
+	plain := l.Wait("key")
+	waitListeners(t, l, 3)
+
+	if n := send(t, l, waitloop.Event{Key: "key"}); n != 2 {
+		t.Fatalf("event reached %d listeners, want the worker and the plain listener", n)
+	}
+	recv(t, worker)
+	recv(t, plain)
+	noRecv(t, idle)
+	waitListeners(t, l, 1)
+}
+
+func TestTerminateNotifiesHigherPrioritiesFirst(t *testing.T) {
+	// The logger hears of each termination as the listener is notified
+	var order []string
+	l := newLoop(t, &waitloop.LoopOptions{Logger: func(_, msg string, keyvals ...interface{}) {
+		if msg == "listener terminated" {
+			order = append(order, keyvals[1].(string))
+		}
+	}})
+	priorities := map[string]int{"low": -1, "plain": 0, "high": 10, "mid": 5, "lower mid": 3}
+	chans := map[string]<-chan waitloop.Event{}
+	for _, key := range []string{"low", "mid", "plain", "high", "lower mid"} {
+		if priorities[key] == 0 {
+			chans[key] = l.Wait(key)
+		} else {
+			chans[key] = l.WaitPriority(key, priorities[key])
+		}
+		waitListeners(t, l, len(chans))
+	}
+
+	l.Terminate()
+	stopped(t, l)
+	want := []string{"high", "mid", "lower mid", "plain", "low"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("terminated in order %v, want %v", order, want)
+	}
+	for key, ch := range chans {
+		if e := recv(t, ch); e.Error != waitloop.ErrLoopTerminated {
+			t.Fatalf("%s got %v, want ErrLoopTerminated", key, e.Error)
+		}
+	}
+}